@@ -2,7 +2,11 @@ module github.com/bravian1/Textblitz
 
 go 1.24.1
 
-require code.sajari.com/docconv v1.3.8
+require (
+	code.sajari.com/docconv v1.3.8
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/text v0.7.0
+)
 
 require (
 	github.com/JalfResi/justext v0.0.0-20170829062021-c0282dea7198 // indirect
@@ -23,6 +27,5 @@ require (
 	github.com/richardlehane/msoleps v1.0.3 // indirect
 	github.com/ssor/bom v0.0.0-20170718123548-6386211fdfcf // indirect
 	golang.org/x/net v0.7.0 // indirect
-	golang.org/x/text v0.7.0 // indirect
 	google.golang.org/protobuf v1.28.0 // indirect
 )
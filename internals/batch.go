@@ -0,0 +1,209 @@
+package internals
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bravian1/Textblitz/simhash"
+)
+
+// BatchQuery is one query of a batch lookup: a SimHash, or text to hash, tagged with an ID
+type BatchQuery struct {
+	ID      string
+	Hash    simhash.Fingerprint
+	Text    string
+	HasHash bool
+	Err     error // set when the query line couldn't be parsed
+}
+
+// BatchResult holds the ranked matches for one batch query
+type BatchResult struct {
+	ID      string
+	SimHash simhash.Fingerprint
+	Matches []Match
+	Err     error
+}
+
+// batchLine is the JSONL form of a batch query
+type batchLine struct {
+	ID   any    `json:"id"`
+	Hash string `json:"hash"`
+	Text string `json:"text"`
+}
+
+// ReadBatchQueries reads batch queries from r, one per line. Blank lines are skipped.
+//
+// Lines starting with '{' are JSON objects with an optional "id" and either a "hash"
+// or a "text" field. Any other line is a SimHash value, or the query text itself when
+// textLines is set; those queries are identified by their line number.
+//
+// A malformed line doesn't stop the batch: its query carries the error instead.
+func ReadBatchQueries(r io.Reader, textLines bool) ([]BatchQuery, error) {
+	var queries []BatchQuery
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		query := BatchQuery{ID: strconv.Itoa(lineNumber)}
+		switch {
+		case strings.HasPrefix(line, "{"):
+			query = parseBatchJSON(line, query)
+		case textLines:
+			query.Text = line
+		default:
+			query.Hash, query.Err = simhash.ParseFingerprint(line)
+			query.HasHash = true
+		}
+		queries = append(queries, query)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch queries: %w", err)
+	}
+	return queries, nil
+}
+
+// parseBatchJSON fills in a query from a JSONL line
+func parseBatchJSON(line string, query BatchQuery) BatchQuery {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+
+	var parsed batchLine
+	if err := decoder.Decode(&parsed); err != nil {
+		query.Err = fmt.Errorf("invalid JSON query: %v", err)
+		return query
+	}
+	if parsed.ID != nil {
+		query.ID = fmt.Sprint(parsed.ID)
+	}
+
+	switch {
+	case parsed.Hash != "" && parsed.Text != "":
+		query.Err = fmt.Errorf("query has both \"hash\" and \"text\"")
+	case parsed.Hash != "":
+		query.Hash, query.Err = simhash.ParseFingerprint(parsed.Hash)
+		query.HasHash = true
+	case strings.TrimSpace(parsed.Text) != "":
+		query.Text = parsed.Text
+	default:
+		query.Err = fmt.Errorf("query needs a \"hash\" or a \"text\" field")
+	}
+	return query
+}
+
+// SearchBatch runs every query against the loaded index using a pool of workers.
+//
+// The index is only loaded once for the whole batch; queries are independent, so they
+// are searched concurrently. Results come back in the same order as the queries.
+// If ctx is cancelled, the remaining queries get ctx.Err() as their error.
+func (im *IndexManager) SearchBatch(ctx context.Context, queries []BatchQuery, opts SearchOptions, workers int) []BatchResult {
+	if workers <= 0 {
+		workers = 1
+	}
+	// building the tables costs several scans of a mapped index, which a batch makes up for
+	if im.mapped != nil && len(queries) > 1 && opts.Threshold > 0 {
+		im.mapped.UseTable()
+	}
+
+	results := make([]BatchResult, len(queries))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = im.searchBatchQuery(ctx, queries[i], opts)
+			}
+		}()
+	}
+
+	for i := range queries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// searchBatchQuery hashes (if needed) and searches a single batch query
+func (im *IndexManager) searchBatchQuery(ctx context.Context, query BatchQuery, opts SearchOptions) BatchResult {
+	result := BatchResult{ID: query.ID, Err: query.Err}
+	if result.Err != nil {
+		return result
+	}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.SimHash = query.Hash
+	if !query.HasHash {
+		result.SimHash = im.HashText(query.Text)
+	}
+	result.Matches = im.Search(result.SimHash, opts)
+	return result
+}
+
+// BatchOutput prints the batch results as text, one block per query
+func BatchOutput(results []BatchResult, format simhash.Format) {
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("Query %s: error: %v\n", result.ID, result.Err)
+			continue
+		}
+
+		fmt.Printf("Query %s (SimHash %s): %d matches\n", result.ID, result.SimHash.Format(format), len(result.Matches))
+		for _, m := range result.Matches {
+			fmt.Printf("  %s  distance %d  %s  byte %d", m.SimHash.Format(format), m.Distance, m.OriginalFile, m.Position)
+			if m.Line > 0 {
+				fmt.Printf("  line %d:%d", m.Line, m.Column)
+			}
+			if place := placeOf(m.IndexEntry); place != "" {
+				fmt.Printf("  %s", place)
+			}
+			fmt.Println()
+		}
+	}
+}
+
+// BatchJSON prints the batch results as JSON lines, one object per query:
+// {"id": ..., "simhash": ..., "matches": [...]} or {"id": ..., "error": "..."}
+func BatchJSON(results []BatchResult, format simhash.Format) error {
+	type jsonResult struct {
+		ID      string           `json:"id"`
+		SimHash *jsonFingerprint `json:"simhash,omitempty"`
+		Matches []jsonMatch      `json:"matches"`
+		Error   string           `json:"error,omitempty"`
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, result := range results {
+		line := jsonResult{ID: result.ID, Matches: []jsonMatch{}}
+		if result.Err != nil {
+			line.Error = result.Err.Error()
+		} else {
+			line.SimHash = &jsonFingerprint{result.SimHash, format}
+			line.Matches = formatMatches(result.Matches, format)
+		}
+		if err := encoder.Encode(line); err != nil {
+			return fmt.Errorf("failed to encode result for query %s: %w", result.ID, err)
+		}
+	}
+	return nil
+}
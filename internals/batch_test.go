@@ -0,0 +1,82 @@
+package internals
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReadBatchQueries(t *testing.T) {
+	input := strings.Join([]string{
+		"0x10",
+		"",
+		"not a hash",
+		`{"id": "first", "hash": "42"}`,
+		`{"id": 7, "text": "some words"}`,
+		`{"id": "both", "hash": "1", "text": "x"}`,
+		`{broken`,
+	}, "\n")
+
+	queries, err := ReadBatchQueries(strings.NewReader(input), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 6 {
+		t.Fatalf("expected 6 queries (blank line skipped), got %d", len(queries))
+	}
+
+	if q := queries[0]; q.ID != "1" || !q.HasHash || q.Hash != 0x10 || q.Err != nil {
+		t.Errorf("plain hash line parsed as %+v", q)
+	}
+	if q := queries[1]; q.ID != "3" || q.Err == nil {
+		t.Errorf("expected an error for an invalid hash line, got %+v", q)
+	}
+	if q := queries[2]; q.ID != "first" || q.Hash != 42 || q.Err != nil {
+		t.Errorf("JSON hash query parsed as %+v", q)
+	}
+	if q := queries[3]; q.ID != "7" || q.HasHash || q.Text != "some words" || q.Err != nil {
+		t.Errorf("JSON text query parsed as %+v", q)
+	}
+	if queries[4].Err == nil || queries[5].Err == nil {
+		t.Error("expected errors for a query with both fields and for broken JSON")
+	}
+
+	textQueries, err := ReadBatchQueries(strings.NewReader("12345\nhello there"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if textQueries[0].HasHash || textQueries[0].Text != "12345" {
+		t.Errorf("expected plain lines to be text queries, got %+v", textQueries[0])
+	}
+}
+
+// Test that batch results line up with their queries and match single searches
+func TestIndexManager_SearchBatch(t *testing.T) {
+	im := NewIndexManager()
+	texts := []string{"alpha beta gamma delta", "the quick brown fox", "lorem ipsum dolor sit amet"}
+	for i, text := range texts {
+		im.Add(FeatureOptions{}.Hash(text).String(), IndexEntry{OriginalFile: "a.txt", Position: i * 100})
+	}
+
+	var queries []BatchQuery
+	for i := 0; i < 30; i++ {
+		queries = append(queries, BatchQuery{ID: texts[i%3], Text: texts[i%3]})
+	}
+	queries = append(queries, BatchQuery{ID: "bad", Err: context.Canceled})
+
+	results := im.SearchBatch(context.Background(), queries, SearchOptions{}, 4)
+	if len(results) != len(queries) {
+		t.Fatalf("expected %d results, got %d", len(queries), len(results))
+	}
+	for i, result := range results[:30] {
+		if result.ID != queries[i].ID {
+			t.Fatalf("result %d has ID %s, want %s", i, result.ID, queries[i].ID)
+		}
+		if len(result.Matches) != 1 || result.Matches[0].Position != (i%3)*100 {
+			t.Errorf("result %d: unexpected matches %+v", i, result.Matches)
+		}
+	}
+	if results[30].Err == nil {
+		t.Error("expected the failed query to keep its error")
+	}
+}
@@ -0,0 +1,824 @@
+package internals
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bravian1/Textblitz/simhash"
+)
+
+// The binary index format.
+//
+// A file starts with the 8-byte magic "TBLZIDX\x00", followed by sections until the end
+// of the file. Every section has a 16-byte header (a 4-byte tag, 4 zero bytes and the
+// uint64 payload length) and its payload is padded with zeros to a multiple of 8 bytes,
+// so every section and every record starts 8-byte aligned. All integers are little endian.
+//
+//	HEAD  the IndexHeader, as a string table of alternating field names and values
+//	STRS  string table: uint32 count, then uint32 length + bytes for each source file path
+//	RECS  uint64 count, then 24-byte records sorted by hash:
+//	      uint64 hash, uint32 file ID (index into STRS), uint32 size, uint64 byte offset
+//	KEYW  optional keywords: count+1 uint64 offsets into a blob, one range per record,
+//	      then the blob itself holding each record's words separated by NUL bytes
+//	LOCS  optional locations: one 24-byte entry per record, in record order:
+//	      uint32 line, uint32 end line, uint32 column, 4 zero bytes, uint64 rune offset
+//	FILS  optional source file records: uint32 count, then for each file a uint32 length
+//	      + path, int64 size, int64 modification time (Unix nanoseconds), 32-byte SHA-256
+//	PAGS  optional pages: one 16-byte entry per record, in record order: uint32 page,
+//	      uint32 end page, uint64 section (byte offset of its heading in the table that
+//	      follows, 0 for none); then a string table of section headings, laid out as STRS
+//	ROWS  optional data records: one 16-byte entry per record, in record order: uint64
+//	      record number, uint64 key (byte offset of the key in the table that follows,
+//	      0 for none); then a string table of keys, laid out as STRS
+//
+// The headings and keys are found by their offsets, so they are only read for the
+// entries that are decoded, however many of them the tables hold.
+//
+// HEAD must come first. Readers skip sections with tags they don't know.
+const (
+	binaryMagic      = "TBLZIDX\x00"
+	sectionHeaderLen = 16
+	recordLen        = 24
+	locationLen      = 24
+	pageLen          = 16
+	rowLen           = 16
+)
+
+var (
+	tagHeader    = [4]byte{'H', 'E', 'A', 'D'}
+	tagStrings   = [4]byte{'S', 'T', 'R', 'S'}
+	tagRecords   = [4]byte{'R', 'E', 'C', 'S'}
+	tagKeywords  = [4]byte{'K', 'E', 'Y', 'W'}
+	tagLocations = [4]byte{'L', 'O', 'C', 'S'}
+	tagFiles     = [4]byte{'F', 'I', 'L', 'S'}
+	tagPages     = [4]byte{'P', 'A', 'G', 'S'}
+	tagRows      = [4]byte{'R', 'O', 'W', 'S'}
+)
+
+// record is one fixed-width entry of the RECS section
+type record struct {
+	hash   uint64
+	fileID uint32
+	size   uint32
+	offset uint64
+	words  []string
+	loc    location
+	page   page
+	row    row
+}
+
+// location is one entry of the LOCS section
+type location struct {
+	line, endLine, column uint32
+	runeOffset            uint64
+}
+
+// page is one entry of the PAGS section, with its section heading
+type page struct {
+	page, endPage uint32
+	section       string
+}
+
+// row is one entry of the ROWS section, with its key: the data record a record indexes
+type row struct {
+	number uint64
+	key    string
+}
+
+// isBinaryIndex reports whether prefix starts with the binary index magic
+func isBinaryIndex(prefix []byte) bool {
+	return bytes.HasPrefix(prefix, []byte(binaryMagic))
+}
+
+// writeBinaryIndex writes header, index and the source file records in the binary index format
+func writeBinaryIndex(w io.Writer, header IndexHeader, index IndexMap, sources []FileRecord) error {
+	records, files, err := buildRecords(index)
+	if err != nil {
+		return err
+	}
+
+	bw := &binaryWriter{w: w}
+	bw.write([]byte(binaryMagic))
+	bw.section(tagHeader, encodeHeader(header))
+	bw.section(tagStrings, encodeStrings(files))
+	bw.section(tagRecords, encodeRecords(records))
+	if hasKeywords(records) {
+		bw.section(tagKeywords, encodeKeywords(records))
+	}
+	if hasLocations(records) {
+		bw.section(tagLocations, encodeLocations(records))
+	}
+	if len(sources) > 0 {
+		bw.section(tagFiles, encodeFiles(sources))
+	}
+	if hasPages(records) {
+		bw.section(tagPages, encodePages(records))
+	}
+	if hasRows(records) {
+		bw.section(tagRows, encodeRows(records))
+	}
+	return bw.err
+}
+
+// buildRecords flattens the index into records sorted by hash, then file, then offset,
+// and collects the source file paths into a string table
+func buildRecords(index IndexMap) ([]record, []string, error) {
+	var records []record
+	var files []string
+	fileIDs := make(map[string]uint32)
+
+	for key, entries := range index {
+		hash, err := simhash.ParseFingerprint(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid index key: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.Size < 0 || entry.Size > math.MaxUint32 || entry.Position < 0 {
+				return nil, nil, fmt.Errorf("entry %s@%d has an invalid size or position", entry.OriginalFile, entry.Position)
+			}
+			if !fitsUint32(entry.Line, entry.EndLine, entry.Column, entry.Page, entry.EndPage) || entry.RuneOffset < 0 || entry.Record < 0 {
+				return nil, nil, fmt.Errorf("entry %s@%d has an invalid location", entry.OriginalFile, entry.Position)
+			}
+			id, ok := fileIDs[entry.OriginalFile]
+			if !ok {
+				id = uint32(len(files))
+				fileIDs[entry.OriginalFile] = id
+				files = append(files, entry.OriginalFile)
+			}
+			records = append(records, record{
+				hash:   uint64(hash),
+				fileID: id,
+				size:   uint32(entry.Size),
+				offset: uint64(entry.Position),
+				words:  entry.AssociatedWords,
+				loc: location{
+					line:       uint32(entry.Line),
+					endLine:    uint32(entry.EndLine),
+					column:     uint32(entry.Column),
+					runeOffset: uint64(entry.RuneOffset),
+				},
+				page: page{
+					page:    uint32(entry.Page),
+					endPage: uint32(entry.EndPage),
+					section: entry.Section,
+				},
+				row: row{
+					number: uint64(entry.Record),
+					key:    entry.Key,
+				},
+			})
+		}
+	}
+
+	slices.SortFunc(records, func(a, b record) int {
+		if a.hash != b.hash {
+			return cmpUint64(a.hash, b.hash)
+		}
+		if c := strings.Compare(files[a.fileID], files[b.fileID]); c != 0 {
+			return c
+		}
+		return cmpUint64(a.offset, b.offset)
+	})
+	return records, files, nil
+}
+
+func fitsUint32(values ...int) bool {
+	for _, v := range values {
+		if v < 0 || v > math.MaxUint32 {
+			return false
+		}
+	}
+	return true
+}
+
+func cmpUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// headerFields lists the header fields under the keys they are stored with in HEAD
+func headerFields(h *IndexHeader) []struct {
+	key   string
+	value any
+} {
+	return []struct {
+		key   string
+		value any
+	}{
+		{"format_version", &h.FormatVersion},
+		{"tool_version", &h.ToolVersion},
+		{"chunk_size", &h.ChunkSize},
+		{"feature_set", &h.FeatureSet},
+		{"ngram_n", &h.NgramN},
+		{"ngram_step", &h.NgramStep},
+		{"normalize", &h.Normalize},
+		{"hash_function", &h.HashFunction},
+		{"split", &h.Split},
+		{"split_tolerance", &h.SplitTolerance},
+		{"min_size", &h.MinSize},
+		{"max_size", &h.MaxSize},
+		{"stride", &h.Stride},
+		{"type", &h.Type},
+		{"encoding", &h.Encoding},
+		{"fields", &h.Fields},
+		{"key", &h.Key},
+		{"extractor", &h.Extractor},
+	}
+}
+
+// encodeHeader writes the header as a string table of alternating keys and values,
+// so fields can be added without breaking older readers
+func encodeHeader(h IndexHeader) []byte {
+	var pairs []string
+	for _, field := range headerFields(&h) {
+		var value string
+		switch v := field.value.(type) {
+		case *int:
+			value = strconv.Itoa(*v)
+		case *string:
+			value = *v
+		case *bool:
+			value = strconv.FormatBool(*v)
+		case *[]string:
+			// a list is a string table of its own, so its values may hold any character
+			if len(*v) > 0 {
+				value = string(encodeStrings(*v))
+			}
+		}
+		pairs = append(pairs, field.key, value)
+	}
+	return encodeStrings(pairs)
+}
+
+func encodeStrings(strs []string) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(strs)))
+	for _, s := range strs {
+		buf = appendString(buf, s)
+	}
+	return buf
+}
+
+func encodeRecords(records []record) []byte {
+	buf := make([]byte, 8, 8+len(records)*recordLen)
+	binary.LittleEndian.PutUint64(buf, uint64(len(records)))
+	for _, r := range records {
+		buf = binary.LittleEndian.AppendUint64(buf, r.hash)
+		buf = binary.LittleEndian.AppendUint32(buf, r.fileID)
+		buf = binary.LittleEndian.AppendUint32(buf, r.size)
+		buf = binary.LittleEndian.AppendUint64(buf, r.offset)
+	}
+	return buf
+}
+
+func hasKeywords(records []record) bool {
+	for _, r := range records {
+		if len(r.words) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeKeywords(records []record) []byte {
+	var blob []byte
+	offsets := make([]byte, 0, (len(records)+1)*8)
+	for _, r := range records {
+		offsets = binary.LittleEndian.AppendUint64(offsets, uint64(len(blob)))
+		blob = append(blob, strings.Join(r.words, "\x00")...)
+	}
+	offsets = binary.LittleEndian.AppendUint64(offsets, uint64(len(blob)))
+	return append(offsets, blob...)
+}
+
+func hasLocations(records []record) bool {
+	for _, r := range records {
+		if r.loc != (location{}) {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeLocations(records []record) []byte {
+	buf := make([]byte, 0, len(records)*locationLen)
+	for _, r := range records {
+		buf = binary.LittleEndian.AppendUint32(buf, r.loc.line)
+		buf = binary.LittleEndian.AppendUint32(buf, r.loc.endLine)
+		buf = binary.LittleEndian.AppendUint32(buf, r.loc.column)
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		buf = binary.LittleEndian.AppendUint64(buf, r.loc.runeOffset)
+	}
+	return buf
+}
+
+func hasPages(records []record) bool {
+	for _, r := range records {
+		if r.page != (page{}) {
+			return true
+		}
+	}
+	return false
+}
+
+func encodePages(records []record) []byte {
+	var sections stringTable
+	buf := make([]byte, 0, len(records)*pageLen)
+	for _, r := range records {
+		buf = binary.LittleEndian.AppendUint32(buf, r.page.page)
+		buf = binary.LittleEndian.AppendUint32(buf, r.page.endPage)
+		buf = binary.LittleEndian.AppendUint64(buf, sections.offset(r.page.section))
+	}
+	return append(buf, sections.bytes()...)
+}
+
+func hasRows(records []record) bool {
+	for _, r := range records {
+		if r.row != (row{}) {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeRows(records []record) []byte {
+	var keys stringTable
+	buf := make([]byte, 0, len(records)*rowLen)
+	for _, r := range records {
+		buf = binary.LittleEndian.AppendUint64(buf, r.row.number)
+		buf = binary.LittleEndian.AppendUint64(buf, keys.offset(r.row.key))
+	}
+	return append(buf, keys.bytes()...)
+}
+
+// stringTable builds the string table of a section, laid out as STRS, holding each
+// string once
+type stringTable struct {
+	buf     []byte // the table after its count
+	count   uint32
+	offsets map[string]uint64
+}
+
+// offset returns where s starts in the table, adding it if it's new, or 0 for "".
+// Strings start after the count, so no string is at 0.
+func (t *stringTable) offset(s string) uint64 {
+	if s == "" {
+		return 0
+	}
+	if offset, ok := t.offsets[s]; ok {
+		return offset
+	}
+	if t.offsets == nil {
+		t.offsets = make(map[string]uint64)
+	}
+	offset := uint64(4 + len(t.buf))
+	t.buf = appendString(t.buf, s)
+	t.count++
+	t.offsets[s] = offset
+	return offset
+}
+
+// bytes returns the table with its count
+func (t *stringTable) bytes() []byte {
+	return append(binary.LittleEndian.AppendUint32(nil, t.count), t.buf...)
+}
+
+func encodeFiles(files []FileRecord) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(files)))
+	for _, f := range files {
+		buf = appendString(buf, f.Path)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(f.Size))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(f.ModTime))
+		var checksum [sha256.Size]byte
+		hex.Decode(checksum[:], []byte(f.Checksum))
+		buf = append(buf, checksum[:]...)
+	}
+	return buf
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+// binaryWriter writes sections and keeps the first error
+type binaryWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (bw *binaryWriter) write(p []byte) {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(p)
+	}
+}
+
+func (bw *binaryWriter) section(tag [4]byte, payload []byte) {
+	var head [sectionHeaderLen]byte
+	copy(head[:4], tag[:])
+	binary.LittleEndian.PutUint64(head[8:], uint64(len(payload)))
+	bw.write(head[:])
+	bw.write(payload)
+	if pad := padding(len(payload)); pad > 0 {
+		bw.write(make([]byte, pad))
+	}
+}
+
+// padding returns the number of zero bytes that align n to 8 bytes
+func padding(n int) int {
+	return (8 - n%8) % 8
+}
+
+// binaryIndex is a parsed binary index file. Its slices point into the file data.
+type binaryIndex struct {
+	header    IndexHeader
+	files     []string
+	records   []byte // RECS payload after the count
+	count     int
+	keywords  []byte // KEYW payload, nil if the index has no keywords
+	locations []byte // LOCS payload, nil if the index has no locations
+	pages     []byte // the entries of the PAGS payload, nil if the index has no pages
+	sections  []byte // the string table of the PAGS payload
+	rows      []byte // the entries of the ROWS payload, nil if the index has no data records
+	keys      []byte // the string table of the ROWS payload
+	manifest  []FileRecord
+}
+
+// parseBinaryIndex splits a binary index file into its sections and checks their sizes.
+// Records and keywords are not decoded or checked, so this takes the same time for any
+// number of records; see validate, entry and indexMap.
+func parseBinaryIndex(data []byte) (*binaryIndex, error) {
+	if !isBinaryIndex(data) {
+		return nil, fmt.Errorf("not a binary index file")
+	}
+
+	bi := &binaryIndex{}
+	rest := data[len(binaryMagic):]
+	first := true
+	for len(rest) > 0 {
+		if len(rest) < sectionHeaderLen {
+			return nil, fmt.Errorf("truncated section header")
+		}
+		var tag [4]byte
+		copy(tag[:], rest[:4])
+		length := binary.LittleEndian.Uint64(rest[8:sectionHeaderLen])
+		rest = rest[sectionHeaderLen:]
+		if length > uint64(len(rest)) {
+			return nil, fmt.Errorf("section %s is truncated", tag[:])
+		}
+		payload := rest[:length]
+		// the padding after the last section may be missing
+		rest = rest[min(uint64(len(rest)), length+uint64(padding(int(length%8)))):]
+
+		if first && tag != tagHeader {
+			return nil, fmt.Errorf("index file does not start with a header")
+		}
+		first = false
+
+		var err error
+		switch tag {
+		case tagHeader:
+			bi.header, err = decodeHeader(payload)
+			if err == nil {
+				err = bi.header.checkVersion()
+			}
+		case tagStrings:
+			bi.files, err = decodeStrings(payload)
+		case tagRecords:
+			err = bi.setRecords(payload)
+		case tagKeywords:
+			bi.keywords = payload
+		case tagLocations:
+			bi.locations = payload
+		case tagFiles:
+			bi.manifest, err = decodeFiles(payload)
+		case tagPages:
+			bi.pages = payload
+		case tagRows:
+			bi.rows = payload
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if first {
+		return nil, fmt.Errorf("index file has no header")
+	}
+	if bi.keywords != nil && len(bi.keywords) < (bi.count+1)*8 {
+		return nil, fmt.Errorf("truncated keyword section")
+	}
+	if bi.locations != nil && len(bi.locations) < bi.count*locationLen {
+		return nil, fmt.Errorf("truncated location section")
+	}
+	// the record count is only known once every section is read
+	var err error
+	if bi.pages, bi.sections, err = bi.splitTable(bi.pages, pageLen, "page"); err != nil {
+		return nil, err
+	}
+	if bi.rows, bi.keys, err = bi.splitTable(bi.rows, rowLen, "row"); err != nil {
+		return nil, err
+	}
+	return bi, nil
+}
+
+// splitTable splits the payload of a section holding an entry of entryLen bytes per
+// record followed by a string table into the entries and the table. The strings are
+// not decoded; see tableString.
+func (bi *binaryIndex) splitTable(payload []byte, entryLen int, name string) ([]byte, []byte, error) {
+	if payload == nil {
+		return nil, nil, nil
+	}
+	if len(payload) < bi.count*entryLen {
+		return nil, nil, fmt.Errorf("truncated %s section", name)
+	}
+	return payload[:bi.count*entryLen], payload[bi.count*entryLen:], nil
+}
+
+// tableString reads the string at offset in a string table, "" for offset 0. It reports
+// false for an offset that doesn't hold a string.
+func tableString(table []byte, offset uint64) (string, bool) {
+	if offset == 0 {
+		return "", true
+	}
+	if offset < 4 || offset >= uint64(len(table)) {
+		return "", false
+	}
+	s, _, err := readString(table[offset:])
+	return s, err == nil
+}
+
+func (bi *binaryIndex) setRecords(payload []byte) error {
+	if len(payload) < 8 {
+		return fmt.Errorf("truncated record section")
+	}
+	count := binary.LittleEndian.Uint64(payload)
+	if count > uint64(len(payload)-8)/recordLen {
+		return fmt.Errorf("record section holds fewer records than its count")
+	}
+	bi.count = int(count)
+	bi.records = payload[8 : 8+bi.count*recordLen]
+	return nil
+}
+
+// validString reports whether offset holds a string of table, see tableString
+func validString(table []byte, offset uint64) bool {
+	_, ok := tableString(table, offset)
+	return ok
+}
+
+// validate checks that every file ID, section and key offset and keyword offset stays inside its section
+func (bi *binaryIndex) validate() error {
+	for i := range bi.count {
+		if r := bi.record(i); int(r.fileID) >= len(bi.files) {
+			return fmt.Errorf("record %d refers to unknown file %d", i, r.fileID)
+		}
+		if bi.pages != nil {
+			if offset := binary.LittleEndian.Uint64(bi.pages[i*pageLen+8:]); !validString(bi.sections, offset) {
+				return fmt.Errorf("record %d refers to a section at unknown offset %d", i, offset)
+			}
+		}
+		if bi.rows != nil {
+			if offset := binary.LittleEndian.Uint64(bi.rows[i*rowLen+8:]); !validString(bi.keys, offset) {
+				return fmt.Errorf("record %d refers to a key at unknown offset %d", i, offset)
+			}
+		}
+	}
+	if bi.keywords == nil {
+		return nil
+	}
+
+	blob := uint64(len(bi.keywordBlob()))
+	prev := uint64(0)
+	for i := range bi.count + 1 {
+		offset := binary.LittleEndian.Uint64(bi.keywords[i*8:])
+		if offset < prev || offset > blob {
+			return fmt.Errorf("keyword offset %d is out of range", i)
+		}
+		prev = offset
+	}
+	return nil
+}
+
+// record decodes the i-th record, without its keywords
+func (bi *binaryIndex) record(i int) record {
+	b := bi.records[i*recordLen : (i+1)*recordLen]
+	return record{
+		hash:   binary.LittleEndian.Uint64(b[0:8]),
+		fileID: binary.LittleEndian.Uint32(b[8:12]),
+		size:   binary.LittleEndian.Uint32(b[12:16]),
+		offset: binary.LittleEndian.Uint64(b[16:24]),
+	}
+}
+
+// wordRange returns where the i-th record's keywords are in the keyword blob
+func (bi *binaryIndex) wordRange(i int) (uint64, uint64) {
+	if bi.keywords == nil {
+		return 0, 0
+	}
+	return binary.LittleEndian.Uint64(bi.keywords[i*8:]), binary.LittleEndian.Uint64(bi.keywords[(i+1)*8:])
+}
+
+// entry decodes the i-th record into an IndexEntry, copying its strings out of the file data.
+// It reports false for a record whose file ID or keyword range is out of bounds.
+func (bi *binaryIndex) entry(i int) (uint64, IndexEntry, bool) {
+	r := bi.record(i)
+	if int(r.fileID) >= len(bi.files) {
+		return 0, IndexEntry{}, false
+	}
+	entry := bi.baseEntry(i, r)
+
+	start, end := bi.wordRange(i)
+	blob := bi.keywordBlob()
+	if start > end || end > uint64(len(blob)) {
+		return 0, IndexEntry{}, false
+	}
+	if start != end {
+		entry.AssociatedWords = strings.Split(string(blob[start:end]), "\x00")
+	}
+	return r.hash, entry, true
+}
+
+// baseEntry builds the IndexEntry of the i-th record r, without its keywords
+func (bi *binaryIndex) baseEntry(i int, r record) IndexEntry {
+	entry := IndexEntry{
+		OriginalFile: bi.files[r.fileID],
+		Size:         int(r.size),
+		Position:     int(r.offset),
+	}
+	if bi.locations != nil {
+		b := bi.locations[i*locationLen : (i+1)*locationLen]
+		entry.Line = int(binary.LittleEndian.Uint32(b[0:4]))
+		entry.EndLine = int(binary.LittleEndian.Uint32(b[4:8]))
+		entry.Column = int(binary.LittleEndian.Uint32(b[8:12]))
+		entry.RuneOffset = int(binary.LittleEndian.Uint64(b[16:24]))
+	}
+	if bi.pages != nil {
+		b := bi.pages[i*pageLen : (i+1)*pageLen]
+		entry.Page = int(binary.LittleEndian.Uint32(b[0:4]))
+		entry.EndPage = int(binary.LittleEndian.Uint32(b[4:8]))
+		entry.Section, _ = tableString(bi.sections, binary.LittleEndian.Uint64(b[8:16]))
+	}
+	if bi.rows != nil {
+		b := bi.rows[i*rowLen : (i+1)*rowLen]
+		entry.Record = int(binary.LittleEndian.Uint64(b[0:8]))
+		entry.Key, _ = tableString(bi.keys, binary.LittleEndian.Uint64(b[8:16]))
+	}
+	return entry
+}
+
+func (bi *binaryIndex) keywordBlob() []byte {
+	if bi.keywords == nil {
+		return nil
+	}
+	return bi.keywords[(bi.count+1)*8:]
+}
+
+// indexMap decodes every record into an IndexMap
+func (bi *binaryIndex) indexMap() IndexMap {
+	// the words of every record are substrings of one copy of the blob,
+	// instead of a separate allocation per record
+	var blob string
+	if bi.keywords != nil {
+		blob = string(bi.keywordBlob())
+	}
+
+	index := make(IndexMap)
+	var key string
+	for i := range bi.count {
+		r := bi.record(i)
+		// records are sorted by hash, so each key only needs formatting once
+		if i == 0 || r.hash != bi.record(i-1).hash {
+			key = strconv.FormatUint(r.hash, 10)
+		}
+
+		entry := bi.baseEntry(i, r)
+		if start, end := bi.wordRange(i); start != end {
+			entry.AssociatedWords = strings.Split(blob[start:end], "\x00")
+		}
+		index[key] = append(index[key], entry)
+	}
+	return index
+}
+
+// decodeHeader reads a header written by encodeHeader. Unknown keys are ignored
+// and missing ones keep their zero value.
+func decodeHeader(payload []byte) (IndexHeader, error) {
+	pairs, err := decodeStrings(payload)
+	if err != nil || len(pairs)%2 != 0 {
+		return IndexHeader{}, fmt.Errorf("invalid index header")
+	}
+	values := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		values[pairs[i]] = pairs[i+1]
+	}
+
+	var h IndexHeader
+	for _, field := range headerFields(&h) {
+		value, ok := values[field.key]
+		if !ok {
+			continue
+		}
+		switch v := field.value.(type) {
+		case *int:
+			*v, err = strconv.Atoi(value)
+		case *string:
+			*v = value
+		case *bool:
+			*v, err = strconv.ParseBool(value)
+		case *[]string:
+			if value != "" {
+				*v, err = decodeStrings([]byte(value))
+			}
+		}
+		if err != nil {
+			return IndexHeader{}, fmt.Errorf("invalid index header field %s: %w", field.key, err)
+		}
+	}
+	return h, nil
+}
+
+func decodeFiles(payload []byte) ([]FileRecord, error) {
+	const fixedLen = 8 + 8 + sha256.Size
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("truncated file section")
+	}
+	count := binary.LittleEndian.Uint32(payload)
+	rest := payload[4:]
+	if uint64(count) > uint64(len(rest))/(4+fixedLen) {
+		return nil, fmt.Errorf("file section holds fewer files than its count")
+	}
+	files := make([]FileRecord, count)
+	for i := range files {
+		path, n, err := readString(rest)
+		if err != nil || len(rest) < n+fixedLen {
+			return nil, fmt.Errorf("truncated file section")
+		}
+		b := rest[n : n+fixedLen]
+		files[i] = FileRecord{
+			Path:     path,
+			Size:     int64(binary.LittleEndian.Uint64(b[0:8])),
+			ModTime:  int64(binary.LittleEndian.Uint64(b[8:16])),
+			Checksum: hex.EncodeToString(b[16:]),
+		}
+		rest = rest[n+fixedLen:]
+	}
+	return files, nil
+}
+
+// fileMap returns the source file records by path, nil if the index has none
+func (bi *binaryIndex) fileMap() map[string]FileRecord {
+	if len(bi.manifest) == 0 {
+		return nil
+	}
+	files := make(map[string]FileRecord, len(bi.manifest))
+	for _, f := range bi.manifest {
+		files[f.Path] = f
+	}
+	return files
+}
+
+func decodeStrings(payload []byte) ([]string, error) {
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("truncated string table")
+	}
+	count := binary.LittleEndian.Uint32(payload)
+	rest := payload[4:]
+	if uint64(count) > uint64(len(rest))/4 {
+		return nil, fmt.Errorf("string table holds fewer strings than its count")
+	}
+	strs := make([]string, count)
+	for i := range strs {
+		s, n, err := readString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string table: %w", err)
+		}
+		strs[i] = s
+		rest = rest[n:]
+	}
+	return strs, nil
+}
+
+// readString reads a length-prefixed string and returns it with the number of bytes used
+func readString(b []byte) (string, int, error) {
+	if len(b) < 4 {
+		return "", 0, fmt.Errorf("truncated string")
+	}
+	length := binary.LittleEndian.Uint32(b)
+	if uint64(length) > uint64(len(b)-4) {
+		return "", 0, fmt.Errorf("truncated string")
+	}
+	return string(b[4 : 4+length]), 4 + int(length), nil
+}
@@ -0,0 +1,224 @@
+package internals
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// testIndex builds an index of n chunks spread over a few files, with keywords, pages
+// and sections for the chunks of the PDF, and record numbers and keys for some others
+func testIndex(n int) *IndexManager {
+	rng := rand.New(rand.NewSource(9))
+	files := []string{"testdata/a.txt", "testdata/b.pdf", "/var/corpus/some/longer/path/c.docx"}
+	words := []string{"the", "jungle", "book", "mowgli", "wolf", "pack", "council", "rock", "bagheera", "baloo"}
+
+	im := NewIndexManager()
+	im.SetHeader(NewIndexHeader(IndexOptions{ChunkSize: 4096, Split: "sentence", Features: FeatureOptions{FeatureSet: "ngram", NgramN: 4}}))
+	for i := range n {
+		entry := IndexEntry{
+			OriginalFile: files[i%len(files)],
+			Size:         4096,
+			Position:     (i / len(files)) * 4096,
+			Line:         (i/len(files))*80 + 1,
+			EndLine:      (i/len(files))*80 + 81,
+			Column:       i%40 + 1,
+			RuneOffset:   (i / len(files)) * 4000,
+		}
+		if entry.OriginalFile == files[1] {
+			// chunks of a document, on a page or across two, in a few sections
+			entry.Page = i/len(files) + 1
+			entry.EndPage = entry.Page + i%2
+			entry.Section = "Chapter " + strconv.Itoa(i/30+1)
+		}
+		if entry.OriginalFile == files[0] && i%2 == 0 {
+			// rows of data, some with a key
+			entry.Record = i/len(files) + 1
+			if i%4 == 0 {
+				entry.Key = "row-" + strconv.Itoa(entry.Record)
+			}
+		}
+		for range 10 {
+			entry.AssociatedWords = append(entry.AssociatedWords, words[rng.Intn(len(words))])
+		}
+		im.Add(strconv.FormatUint(rng.Uint64(), 10), entry)
+	}
+	return im
+}
+
+// Test that an index survives SaveBinary and LoadBinary unchanged
+func TestIndexManager_BinaryRoundTrip(t *testing.T) {
+	im := testIndex(500)
+	// a bucket with several entries, and an entry without keywords
+	im.Add("42", IndexEntry{OriginalFile: "testdata/a.txt", Size: 100, Position: 1 << 40})
+	im.Add("42", IndexEntry{OriginalFile: "new.txt", Size: 7, Position: 0, AssociatedWords: []string{"only"}})
+
+	var buf bytes.Buffer
+	if err := im.SaveBinary(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewIndexManager()
+	if err := loaded.LoadBinary(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded.Header(), im.savedHeader(IndexFormatVersion)) {
+		t.Errorf("header = %+v, want %+v", loaded.Header(), im.savedHeader(IndexFormatVersion))
+	}
+	if len(loaded.index) != len(im.index) {
+		t.Fatalf("expected %d keys, got %d", len(im.index), len(loaded.index))
+	}
+	for key, entries := range im.index {
+		got := loaded.index[key]
+		if len(got) != len(entries) {
+			t.Fatalf("key %s: expected %d entries, got %d", key, len(entries), len(got))
+		}
+		for _, want := range entries {
+			found := false
+			for _, e := range got {
+				found = found || reflect.DeepEqual(e, want)
+			}
+			if !found {
+				t.Errorf("key %s: entry %+v missing after round trip", key, want)
+			}
+		}
+	}
+}
+
+// Test that Load tells the binary format from gob indexes
+func TestIndexManager_LoadDetectsFormat(t *testing.T) {
+	im := testIndex(50)
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "binary.idx")
+	if err := im.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	gobPath := filepath.Join(dir, "gob.idx")
+	var buf bytes.Buffer
+	if err := im.SaveGob(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(gobPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{path, gobPath} {
+		loaded := NewIndexManager()
+		if err := loaded.Load(p); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(p), err)
+		}
+		if !reflect.DeepEqual(loaded.Header().Features(), im.Header().Features()) {
+			t.Errorf("%s: features = %s, want %s", filepath.Base(p), loaded.Header().Features(), im.Header().Features())
+		}
+		if loaded.Len() != im.Len() {
+			t.Errorf("%s: expected %d entries, got %d", filepath.Base(p), im.Len(), loaded.Len())
+		}
+		loaded.Close()
+	}
+}
+
+// Test that damaged binary files are rejected instead of loading garbage
+func TestParseBinaryIndex_Corrupt(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testIndex(20).SaveBinary(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	for _, n := range []int{len(binaryMagic) + 4, len(data) / 2, len(data) - 20} {
+		if _, err := parseBinaryIndex(data[:n]); err == nil {
+			t.Errorf("expected an error for a file truncated to %d bytes", n)
+		}
+	}
+
+	var noHeader bytes.Buffer
+	bw := &binaryWriter{w: &noHeader}
+	bw.write([]byte(binaryMagic))
+	bw.section(tagStrings, encodeStrings([]string{"a.txt"}))
+	if _, err := parseBinaryIndex(noHeader.Bytes()); err == nil {
+		t.Error("expected an error for a file that doesn't start with a header")
+	}
+
+	if err := NewIndexManager().SaveBinary(&bytes.Buffer{}); err != nil {
+		t.Errorf("expected an empty index to save, got %v", err)
+	}
+	bad := NewIndexManager()
+	bad.Add("not-a-hash", IndexEntry{})
+	if err := bad.SaveBinary(&bytes.Buffer{}); err == nil {
+		t.Error("expected an error saving a key that isn't a SimHash")
+	}
+
+	// keys are parsed the way searches parse them, whatever format they are written in
+	hex := NewIndexManager()
+	hex.Add("0xff", IndexEntry{OriginalFile: "a.txt", Size: 1})
+	var saved bytes.Buffer
+	if err := hex.SaveBinary(&saved); err != nil {
+		t.Fatalf("expected a hex key to save, got %v", err)
+	}
+	bi, err := parseBinaryIndex(saved.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := bi.indexMap()["255"]; len(entries) != 1 {
+		t.Errorf("expected the entry under SimHash 255, got %v", bi.indexMap())
+	}
+}
+
+// Test that section headings and keys are read by their offsets, and bad offsets are caught
+func TestParseBinaryIndex_StringOffsets(t *testing.T) {
+	im := NewIndexManager()
+	im.Add("1", IndexEntry{OriginalFile: "a.csv", Size: 4, Record: 1, Key: "k-1"})
+	im.Add("2", IndexEntry{OriginalFile: "a.csv", Size: 4, Position: 4, Record: 2, Key: "k-2"})
+	var buf bytes.Buffer
+	if err := im.SaveBinary(&buf); err != nil {
+		t.Fatal(err)
+	}
+	bi, err := parseBinaryIndex(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, entry, _ := bi.entry(1); entry.Key != "k-2" || entry.Record != 2 {
+		t.Fatalf("unexpected second entry %+v", entry)
+	}
+
+	// point the first record's key past the end of the table
+	binary.LittleEndian.PutUint64(bi.rows[8:], uint64(len(bi.keys)))
+	if _, entry, _ := bi.entry(0); entry.Key != "" {
+		t.Errorf("expected no key at a bad offset, got %q", entry.Key)
+	}
+	if err := bi.validate(); err == nil {
+		t.Error("expected validate to catch the bad key offset")
+	}
+}
+
+func benchmarkLoad(b *testing.B, save func(*IndexManager, *bytes.Buffer) error, load func(*IndexManager, *bytes.Reader) error) {
+	var buf bytes.Buffer
+	if err := save(testIndex(100_000), &buf); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for range b.N {
+		if err := load(NewIndexManager(), bytes.NewReader(buf.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(buf.Len()), "file-bytes")
+}
+
+func BenchmarkLoad_Gob(b *testing.B) {
+	benchmarkLoad(b,
+		func(im *IndexManager, w *bytes.Buffer) error { return im.SaveGob(w) },
+		func(im *IndexManager, r *bytes.Reader) error { return im.LoadGob(r) })
+}
+
+func BenchmarkLoad_Binary(b *testing.B) {
+	benchmarkLoad(b,
+		func(im *IndexManager, w *bytes.Buffer) error { return im.SaveBinary(w) },
+		func(im *IndexManager, r *bytes.Reader) error { return im.LoadBinary(r) })
+}
@@ -4,17 +4,74 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+
+	"github.com/bravian1/Textblitz/simhash"
 )
 
 // CLIflags holds the parsed command line arguments
 type CLIFlags struct {
-	Command    string //index/look up
-	InputFile  string //path to .txt file (for  index) or .idx file (for look up)
-	ChunkSize  int    //chunk size (bytes)
-	OutputFile string //path to output.idx file
-	SimHash    string //simhash value to search
-	WorkerPool int    //number of worker goroutines
-	Threshold  int    // distance for fuzzy lookup
+	Command       string //index/look up/hash
+	InputFile     string //path to .txt file (for  index) or .idx file (for look up)
+	ChunkSize     int    //chunk size (bytes)
+	Split         string //where chunks end: bytes, word, sentence, paragraph, cdc or record
+	Tolerance     int    //how far (bytes) a chunk may end from the chunk size to reach a boundary
+	MinSize       int    //smallest content-defined chunk (cdc)
+	MaxSize       int    //largest content-defined chunk (cdc)
+	Stride        int    //bytes between the starts of overlapping chunks, 0 for no overlap
+	OutputFile    string //path to output.idx file
+	SimHash       string //simhash value to search
+	QueryText     string //text to hash and search (lookup/hash)
+	QueryFile     string //file holding the text to hash and search, "-" for stdin (lookup/hash), or the query list (batch)
+	TextQueries   bool   //plain batch query lines are text to hash rather than SimHash values
+	FeatureSet    string //feature set to hash with: word or ngram
+	NgramN        int    //n-gram size (ngram feature set)
+	NgramStep     int    //n-gram window step (ngram feature set)
+	CaseSensitive bool   //don't lowercase text before extracting features
+	FeaturesSet   bool   //true if any feature flag was given explicitly
+	WorkerPool    int    //number of worker goroutines
+	Threshold     int    // distance for fuzzy lookup
+	TopK          int    //max number of lookup results, 0 for all
+	Offset        int    //number of ranked lookup results to skip
+	JSON          bool   //print lookup results as JSON
+	HashFormat    string //how SimHash values are printed: decimal, hex or binary
+	WithText      bool   //print the matched chunk text with lookup results
+	Links         bool   //print lookup results as path:line:col links
+	Context       int    //bytes of context around chunk text (lookup --with-text/show)
+	Position      int    //byte position of the chunk to show
+	SourceFile    string //source file of the chunk to show (when the index covers several files), or the files to remove
+
+	// picking the files of a directory or glob input (index)
+	Include     patternList //patterns of files to index
+	Exclude     patternList //patterns of files and directories to skip
+	FollowLinks bool        //follow symlinks while walking directories
+	FileWorkers int         //number of files indexed at once
+	Update      bool        //only re-index files that changed since the index at -o was built
+	Name        string      //OriginalFile label of text indexed from stdin (-i -)
+	Type        string      //type of every input instead of the detected one: text, pdf, docx, xml or html
+	Encoding    string      //encoding of every text input instead of the detected one, e.g. latin1 or utf-16le
+	Fields      patternList //columns or JSON fields of each record to hash (--split record)
+	Key         string      //column or JSON field that identifies each record (--split record)
+	ChunkingSet bool        //true if any chunking or feature flag was given explicitly
+
+	// Indexes lists the index files to merge: -i, if given, then the arguments after the flags (merge)
+	Indexes []string
+}
+
+// patternList is a flag that can be repeated or given a comma-separated list
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			*p = append(*p, pattern)
+		}
+	}
+	return nil
 }
 
 // Parseflags parses command line arguments and returns a CLIFlags struct
@@ -23,13 +80,44 @@ func ParseFlags() (CLIFlags, error) {
 	flagSet := flag.NewFlagSet("textblitz", flag.ExitOnError)
 
 	//flags
-	flagSet.StringVar(&config.Command, "c", "", "Command: 'index' to index a file, 'lookup to search a hash ")
+	flagSet.StringVar(&config.Command, "c", "", "Command: 'index' to index a file, 'lookup' to search a hash, 'batch' to search many, 'show' to print a chunk, 'hash' to fingerprint text, 'merge' to combine indexes, 'remove' to drop files from an index")
 	flagSet.StringVar(&config.InputFile, "i", "", "Input file(text file for  index, .idx for  lookup)")
 	flagSet.IntVar(&config.ChunkSize, "s", 4096, "Chunk size in bytes (default 4096)")
+	flagSet.StringVar(&config.Split, "split", "bytes", "Where chunks end: 'bytes' (exactly every -s bytes), 'word', 'sentence', 'paragraph', 'cdc' (content-defined) or 'record' (a chunk per CSV row, JSONL object or line)")
+	flagSet.IntVar(&config.Tolerance, "split-tolerance", 0, "How far (bytes) a chunk may end from -s to reach a boundary (default -s/4)")
+	flagSet.IntVar(&config.MinSize, "min-size", 0, "Smallest content-defined chunk in bytes (default -s/4)")
+	flagSet.IntVar(&config.MaxSize, "max-size", 0, "Largest content-defined chunk in bytes (default -s*4)")
+	flagSet.IntVar(&config.Stride, "stride", 0, "Start a -s byte chunk every n bytes, so chunks overlap (default -s, no overlap)")
 	flagSet.StringVar(&config.OutputFile, "o", "", "Output index file (.idx) .Required for 'index' command")
-	flagSet.StringVar(&config.SimHash, "h", "", "Simhash value to search (required for 'lookup' command)")
+	flagSet.StringVar(&config.SimHash, "h", "", "Simhash value to search, in decimal, hex (optionally 0x-prefixed) or 64-digit binary")
+	flagSet.StringVar(&config.QueryText, "q", "", "Query text to hash and search (alternative to -h)")
+	flagSet.StringVar(&config.QueryFile, "f", "", "File with the query text to hash and search, '-' for stdin (alternative to -h)")
+	flagSet.BoolVar(&config.TextQueries, "text-queries", false, "Treat plain lines of a batch query file as text to hash instead of SimHash values (batch)")
+	flagSet.StringVar(&config.FeatureSet, "features", "word", "Feature set used to hash text: 'word' or 'ngram'")
+	flagSet.IntVar(&config.NgramN, "ngram-n", 3, "N-gram size for the ngram feature set")
+	flagSet.IntVar(&config.NgramStep, "ngram-step", 1, "N-gram window step for the ngram feature set")
+	flagSet.BoolVar(&config.CaseSensitive, "case-sensitive", false, "Don't lowercase text before extracting features")
 	flagSet.IntVar(&config.WorkerPool, "w", 4, "Number of worker goroutines (default 4)")
 	flagSet.IntVar(&config.Threshold, "t", 0, "Distance for fuzzy lookup (default 0)")
+	flagSet.IntVar(&config.TopK, "k", 0, "Return only the k closest matches (default 0, all matches)")
+	flagSet.IntVar(&config.Offset, "offset", 0, "Skip this many ranked matches, for paging (default 0)")
+	flagSet.BoolVar(&config.JSON, "json", false, "Print lookup results as JSON")
+	flagSet.StringVar(&config.HashFormat, "hash-format", "decimal", "How SimHash values are shown in the index JSON, lookup and hash output: decimal, hex or binary")
+	flagSet.BoolVar(&config.WithText, "with-text", false, "Print the text of each matched chunk (lookup)")
+	flagSet.BoolVar(&config.Links, "links", false, "Print each lookup match as a path:line:col link")
+	flagSet.IntVar(&config.Context, "context", 0, "Bytes of context to print before and after chunk text (default 0)")
+	flagSet.IntVar(&config.Position, "p", -1, "Byte position of the chunk to show (required for 'show' command)")
+	flagSet.StringVar(&config.SourceFile, "file", "", "Source file of the chunk to show, when the index covers several files, or path or glob of the files to remove")
+	flagSet.Var(&config.Include, "include", "Only index files matching these patterns from a directory or glob (repeatable or comma-separated)")
+	flagSet.Var(&config.Exclude, "exclude", "Skip files and directories matching these patterns (repeatable or comma-separated)")
+	flagSet.BoolVar(&config.FollowLinks, "follow-symlinks", false, "Follow symbolic links while walking directories instead of skipping them")
+	flagSet.IntVar(&config.FileWorkers, "file-workers", 4, "Number of files indexed at once (default 4)")
+	flagSet.BoolVar(&config.Update, "update", false, "Update the index at -o: only index new and changed files, and drop removed ones")
+	flagSet.StringVar(&config.Name, "name", "", "Source file label of the text indexed from stdin with '-i -' (default: stdin)")
+	flagSet.StringVar(&config.Type, "type", "", "Read every input as this type instead of the one detected from its content: text, pdf, docx, xml or html")
+	flagSet.StringVar(&config.Encoding, "encoding", "", "Read text in this encoding instead of the detected one, e.g. latin1, windows-1252 or utf-16le")
+	flagSet.Var(&config.Fields, "fields", "Columns or JSON fields of each record to hash with --split record (repeatable or comma-separated; default all)")
+	flagSet.StringVar(&config.Key, "key", "", "Column or JSON field whose value identifies each record with --split record")
 	help := flagSet.Bool("help", false, "Display help message")
 
 	err := flagSet.Parse(os.Args[1:])
@@ -42,22 +130,135 @@ func ParseFlags() (CLIFlags, error) {
 		return config, fmt.Errorf("help message displayed")
 	}
 
+	// lookups take the feature settings from the index header unless they are given explicitly
+	flagSet.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "features", "ngram-n", "ngram-step", "case-sensitive":
+			config.FeaturesSet = true
+			config.ChunkingSet = true
+		case "s", "split", "split-tolerance", "min-size", "max-size", "stride", "encoding", "fields", "key":
+			config.ChunkingSet = true
+		}
+	})
+
+	if config.InputFile != "" {
+		config.Indexes = append(config.Indexes, config.InputFile)
+	}
+	config.Indexes = append(config.Indexes, flagSet.Args()...)
+
 	//validate flags
 	if config.Command == "" {
-		return config, fmt.Errorf("error: missing command (-c 'index' or 'lookup'). Use --help for details")
+		return config, fmt.Errorf("error: missing command (-c 'index', 'lookup', 'batch', 'show', 'hash', 'merge' or 'remove'). Use --help for details")
 	}
 
 	if config.Command == "index" && (config.InputFile == "" || config.OutputFile == "") {
 		return config, fmt.Errorf("error: input file (-i <input_file.txt> )or output file (-o <index.idx>)  are required for indexing. Use --help for details")
 	}
 
-	if config.Command == "lookup" && (config.InputFile == "" || config.SimHash == "") {
-		return config, fmt.Errorf("error: input file (-i <index_file.idx>) or simhash (-h <simhash_value>)  are required for lookup. Use --help for details")
+	hasQuery := config.SimHash != "" || config.QueryText != "" || config.QueryFile != ""
+
+	if config.Command == "lookup" && (config.InputFile == "" || !hasQuery) {
+		return config, fmt.Errorf("error: input file (-i <index_file.idx>) and a query (-h <simhash_value>, -q <text> or -f <file>) are required for lookup. Use --help for details")
+	}
+
+	if config.Command == "index" && config.InputFile == "-" && config.Update {
+		return config, fmt.Errorf("error: --update needs files to compare with the index, it can't read stdin (-i -). Use --help for details")
+	}
+
+	if config.Command == "index" && config.Name != "" && config.InputFile != "-" {
+		return config, fmt.Errorf("error: --name labels text read from stdin; use it with -i -. Use --help for details")
+	}
+
+	if config.Command == "index" {
+		if err := config.IndexOptions().validate(); err != nil {
+			return config, fmt.Errorf("error: %v. Use --help for details", err)
+		}
+		if err := config.WalkOptions().validate(); err != nil {
+			return config, fmt.Errorf("error: %v. Use --help for details", err)
+		}
+	}
+
+	if err := config.Features().Validate(); err != nil {
+		return config, fmt.Errorf("error: %v. Use --help for details", err)
+	}
+
+	if _, err := simhash.ParseFormat(config.HashFormat); err != nil {
+		return config, fmt.Errorf("error: %v. Use --help for details", err)
+	}
+
+	if config.TopK < 0 || config.Offset < 0 {
+		return config, fmt.Errorf("error: -k and --offset must not be negative. Use --help for details")
+	}
+
+	if config.Command == "batch" && (config.InputFile == "" || config.QueryFile == "") {
+		return config, fmt.Errorf("error: input file (-i <index_file.idx>) and query file (-f <queries>, '-f -' for stdin) are required for batch. Use --help for details")
+	}
+
+	if config.Command == "show" && (config.InputFile == "" || config.Position < 0) {
+		return config, fmt.Errorf("error: input file (-i <index_file.idx>) and chunk position (-p <byte_offset>) are required for show. Use --help for details")
+	}
+
+	if config.Command == "hash" && config.QueryText == "" && config.QueryFile == "" {
+		return config, fmt.Errorf("error: text to hash (-q <text> or -f <file>, '-f -' for stdin) is required for hash. Use --help for details")
+	}
+
+	if config.Command == "merge" && (config.OutputFile == "" || len(config.Indexes) == 0) {
+		return config, fmt.Errorf("error: output file (-o <index.idx>) and the index files to merge (listed after the flags) are required for merge. Use --help for details")
+	}
+
+	if config.Command == "remove" && (config.InputFile == "" || config.SourceFile == "") {
+		return config, fmt.Errorf("error: input file (-i <index_file.idx>) and the files to remove (--file <path|glob>) are required for remove. Use --help for details")
 	}
 
 	return config, nil
 }
 
+// Format returns the --hash-format value as a simhash.Format (ParseFlags has already validated it)
+func (c CLIFlags) Format() simhash.Format {
+	format, _ := simhash.ParseFormat(c.HashFormat)
+	return format
+}
+
+// IndexOptions returns the chunking, worker and feature flags as IndexOptions
+func (c CLIFlags) IndexOptions() IndexOptions {
+	return IndexOptions{
+		ChunkSize: c.ChunkSize,
+		Workers:   c.WorkerPool,
+		Features:  c.Features(),
+		Split:     c.Split,
+		Tolerance: c.Tolerance,
+		MinSize:   c.MinSize,
+		MaxSize:   c.MaxSize,
+		Stride:    c.Stride,
+
+		FileWorkers: c.FileWorkers,
+		Name:        c.Name,
+		Type:        c.Type,
+		Encoding:    c.Encoding,
+		Fields:      c.Fields,
+		Key:         c.Key,
+	}
+}
+
+// WalkOptions returns the flags that pick the files of a directory or glob input
+func (c CLIFlags) WalkOptions() WalkOptions {
+	return WalkOptions{
+		Include:        c.Include,
+		Exclude:        c.Exclude,
+		FollowSymlinks: c.FollowLinks,
+	}
+}
+
+// Features returns the feature flags as FeatureOptions
+func (c CLIFlags) Features() FeatureOptions {
+	return FeatureOptions{
+		FeatureSet:    c.FeatureSet,
+		NgramN:        c.NgramN,
+		NgramStep:     c.NgramStep,
+		CaseSensitive: c.CaseSensitive,
+	}
+}
+
 // print help message
 func PrintHelp() {
 	fmt.Println(`TextIndex CLI - Fast & Scalable Text Indexer
@@ -65,19 +266,87 @@ func PrintHelp() {
 A command-line tool for indexing large text files and performing fast lookups using SimHash.
 
 Usage:
-  textindex -c index -i <input_file> -s <chunk_size> -o <index_file> [-w <workers>]
-  textindex -c lookup -i <index_file> -h <simhash_value> [-t <threshold>]
+  textindex -c index -i <file|dir|glob> -s <chunk_size> -o <index_file> [-w <workers>] [--stride <n>] [--split <mode>] [--min-size <n>] [--max-size <n>] [--fields <f>] [--key <f>] [--features word|ngram]
+  textindex -c lookup -i <index_file> -h <simhash_value> [-t <threshold>] [-k <count>] [--offset <n>] [--json|--links]
+  textindex -c lookup -i <index_file> (-q <text> | -f <query_file>) [-t <threshold>] [-k <count>] [--offset <n>] [--json|--links]
+  textindex -c batch -i <index_file> -f <query_file> [--text-queries] [-t <threshold>] [-k <count>] [-w <workers>] [--json]
+  textindex -c show -i <index_file> -p <position> [--file <source_file>] [--context <bytes>]
+  textindex -c hash (-q <text> | -f <file>) [-i <index_file>]
+  textindex -c merge -o <index_file> <index_file>...
+  textindex -c remove -i <index_file> --file <path|glob>
 
 Commands:
-  -c index   : Index a file by splitting it into chunks, computing SimHash, and saving the index.
+  -c index   : Index a file, a directory tree or a glob by splitting into chunks, computing SimHash, and saving the index.
   -c lookup  : Find a chunk in the indexed file based on its SimHash (fuzzy matching enabled by threshold)..
+  -c batch   : Load the index once and look up every query in a file (or stdin), one per line or as JSONL.
+  -c show    : Print the text of the indexed chunk at a byte position, read back from its source file.
+  -c hash    : Print the SimHash of a string, a file or stdin.
+  -c merge   : Combine indexes built with the same chunking and feature settings into one, without duplicate entries.
+  -c remove  : Drop the entries of retracted files from an index and save it in place.
 
 Arguments:
-  -i <file>      : Input file (text file for indexing, .idx file for lookup).
+  -i <file>      : Input file (text file for indexing, .idx file for lookup). For indexing it can also be
+                   a directory, walked recursively, or a glob pattern such as "docs/**/*.pdf". '-' indexes
+                   text read from stdin. Compressed files (.gz, .bz2, .xz) are decompressed, and every file
+                   inside a .zip or .tar(.gz) archive is indexed as "bundle.zip!/docs/a.txt".
+  --name <name>  : Source file recorded for the text indexed from stdin (default: stdin).
+  --type <type>  : Read every input as text, pdf, docx, xml or html. By default the type is detected from
+                   the content (PDF header, zip container, UTF-16 byte order mark, markup), whatever the
+                   file is called, and files that aren't text are skipped with the reason.
+  --encoding <e> : Read text in encoding e (latin1, windows-1252, utf-16le, utf-16be, koi8-r, ...) instead of
+                   the detected one: a byte order mark, UTF-16, UTF-8, and windows-1252 for anything else.
+                   Text is hashed as UTF-8, and positions are byte offsets in the original file.
+  --include <p>  : Only index files matching p from a directory or glob (default: .txt, .csv, .tsv, .jsonl,
+                   .pdf, .docx, .xml and .html files and files without an extension, those compressed with
+                   gzip, bzip2 or xz, and .zip and .tar archives).
+                   Patterns without a '/' match file names, others the path below the directory; '**'
+                   matches any number of directories. Repeat the flag or separate patterns with commas.
+  --exclude <p>  : Skip files and directories matching p.
+  --follow-symlinks : Follow symbolic links while walking directories (default: skip them).
+  --file-workers <n> : Number of files indexed at once (default: 4). Each file uses -w hashing workers.
+  --update       : Update the existing index at -o instead of rebuilding it: only new and changed files are
+                   indexed, entries of files no longer in the input are dropped, the rest is left as it is.
+                   Files are chunked with the settings recorded in the index.
   -s <size>      : Chunk size in bytes (default: 4096).
-  -o <file>      : Output index file (required for indexing).
-  -h <simhash>   : SimHash value to search for (required for lookup).
-  -w <workers>   : Number of workers (Goroutines) for parallel indexing (default: 4).
+  -o <file>      : Output index file (required for indexing and merge).
+  -h <simhash>   : SimHash value to search for: decimal, hex (3e4f1b2c98a6 or 0x3e4f1b2c98a6) or 64-digit binary.
+  -q <text>      : Text to hash and search for (instead of -h), or to fingerprint with hash.
+  -f <file>      : File holding the text to hash, '-' reads stdin (instead of -h or -q).
+  -k <count>     : Return only the k closest matches (default: 0, all matches).
+  --offset <n>   : Skip the first n ranked matches, to page through results (default: 0).
+  --json         : Print lookup results as a JSON array.
+  --links        : Print one path:line:col line per lookup match, which terminals and editors open as a link.
+  --hash-format <f> : Show SimHash values as decimal (default), hex or binary in the index JSON, lookup and hash output.
+  -p <position>  : Byte position of the chunk to show (required for show).
+  --file <file>  : Source file of the chunk to show, when the index covers several files. For remove, the
+                   file whose entries to drop, as it was indexed, or a glob: "*.pdf" matches file names,
+                   "docs/drafts/**" whole paths.
+  --with-text    : Print the text of each matched chunk with the lookup results.
+  --context <n>  : Bytes of context to print before and after chunk text (default 0).
+  --text-queries : Plain lines of a batch query file are text to hash, not SimHash values.
+  --split <mode> : Where chunks end (index): bytes (default, exactly every -s bytes), word, sentence,
+                   paragraph, cdc or record. Boundary modes end each chunk on the boundary nearest to -s bytes.
+                   cdc cuts where the content says to, averaging -s bytes, so an edit only changes
+                   the chunks around it. record hashes every row of a .csv or .tsv file (after the
+                   header row), every object of a .jsonl file and every line of other text on its own.
+  --fields <f>   : Columns (by header name or number from 1) or JSON fields ("user.name" for nested
+                   ones) whose values are hashed with --split record (default: all of them).
+  --key <f>      : Column or JSON field whose value is recorded with each record, to identify the rows
+                   lookups return (--split record).
+  --split-tolerance <n> : How far (bytes) a chunk may end from -s to reach a boundary (default: -s/4).
+                   With no boundary in range the chunk is cut at -s, never inside a UTF-8 character.
+  --min-size <n> : Smallest chunk with --split cdc (default: -s/4).
+  --max-size <n> : Largest chunk with --split cdc (default: -s*4).
+  --stride <n>   : Start a chunk of -s bytes every n bytes, so chunks overlap and text near a chunk
+                   edge is also in the middle of another chunk (default: -s, no overlap). Lookups
+                   merge hits on overlapping chunks of the same file into one span.
+  --features <f> : Feature set used to hash text: word (default) or ngram.
+  --ngram-n <n>  : N-gram size for the ngram feature set (default: 3).
+  --ngram-step <n> : N-gram window step for the ngram feature set (default: 1).
+  --case-sensitive : Don't lowercase text before extracting features.
+                   Lookups hash query text with the settings recorded in the index; giving
+                   feature flags that don't match the index is an error.
+  -w <workers>   : Number of workers (Goroutines) for parallel indexing and batch lookups (default: 4).
   -t <threshold> : Distance for fuzzy lookup (default 0).
   --help         : Display this help message.
 
@@ -85,9 +354,78 @@ Example Usage:
   # Index a file with 4KB chunks using 4 workers
   textindex -c index -i large_text.txt -s 4096 -o index.idx -w 4
 
+  # Index a whole document tree into one index, skipping drafts
+  textindex -c index -i docs/ -o docs.idx --exclude "drafts/**" --exclude "*.tmp.txt"
+
+  # Re-index only what changed in docs/ since docs.idx was built
+  textindex -c index -i docs/ -o docs.idx --update
+
+  # Index text produced by another program, labelled as the file it came from
+  pg_dump mydb | textindex -c index -i - --name mydb.sql -o mydb.idx
+
+  # Index a log file that has stray control characters as text anyway
+  textindex -c index -i server.log -o logs.idx --type text
+
+  # Index legacy documents written in Latin-1
+  textindex -c index -i archive/1998/ -o 1998.idx --encoding latin1
+
+  # Index the PDFs anywhere below reports/
+  textindex -c index -i "reports/**/*.pdf" -o reports.idx
+
+  # Index with character trigrams instead of words
+  textindex -c index -i large_text.txt -o index.idx --features ngram --ngram-n 3
+
+  # Index with chunks of about 4KB that end between sentences
+  textindex -c index -i large_text.txt -s 4096 -o index.idx --split sentence
+
+  # Index 4KB windows that start every 1KB, so every passage is inside some window
+  textindex -c index -i large_text.txt -s 4096 -o index.idx --stride 1024
+
+  # Index every row of a CSV export by its name and address columns, identified by its id column
+  textindex -c index -i customers.csv -o customers.idx --split record --fields name,address --key id
+
+  # Index with content-defined chunks averaging 4KB, between 1KB and 16KB
+  textindex -c index -i large_text.txt -s 4096 -o index.idx --split cdc --min-size 1024 --max-size 16384
+
   # Lookup a SimHash value in an index file with a threshold of 2
   textindex -c lookup -i index.idx -h 3e4f1b2c98a6 -t 2
 
+  # Lookup by text instead of a precomputed SimHash
+  textindex -c lookup -i index.idx -q "the quick brown fox" -t 3
+  cat passage.txt | textindex -c lookup -i index.idx -f -
+
+  # The 10 closest matches as JSON, then the next 10
+  textindex -c lookup -i index.idx -h 3e4f1b2c98a6 -t 5 -k 10 --json
+  textindex -c lookup -i index.idx -h 3e4f1b2c98a6 -t 5 -k 10 --offset 10 --json
+
+  # Combine the indexes of two departments into one
+  textindex -c merge -o combined.idx sales.idx support.idx
+
+  # Drop a retracted document, or every draft, from an index
+  textindex -c remove -i docs.idx --file docs/retracted.pdf
+  textindex -c remove -i docs.idx --file "docs/drafts/**"
+
+  # Look up every SimHash in a file (one per line) and print JSON lines
+  textindex -c batch -i index.idx -f hashes.txt -t 3 -k 5 --json
+
+  # Batch of text queries from stdin
+  cat queries.txt | textindex -c batch -i index.idx -f - --text-queries
+
+  # Print matches as file:line:col links
+  textindex -c lookup -i index.idx -q "the quick brown fox" -t 3 --links
+
+  # Print matches together with their text and 200 bytes of context
+  textindex -c lookup -i index.idx -h 3e4f1b2c98a6 -t 2 --with-text --context 200
+
+  # Print the chunk that starts at byte 8192
+  textindex -c show -i index.idx -p 8192
+
+  # Print the SimHash of a file, in hex
+  textindex -c hash -f passage.txt --hash-format hex
+
+  # Print the SimHash of a file, hashed the way index.idx was built
+  textindex -c hash -f passage.txt -i index.idx
+
 Error Handling:
   - "File not found"  : Ensure the input file exists.
   - "Invalid chunk size" : Use a valid numeric chunk size (e.g., 1024, 4096).
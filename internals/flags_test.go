@@ -2,6 +2,7 @@ package internals
 
 import (
 	"os"
+	"slices"
 	"testing"
 )
 
@@ -96,3 +97,234 @@ func TestParseFlags_HelpFlag(t *testing.T) {
         t.Error("Expected error for help flag, but found none")
     }
 }
+
+// Test lookup by query text instead of a SimHash
+func TestParseFlags_LookupByQuery(t *testing.T) {
+	resetArgs([]string{"-c", "lookup", "-i", "index.idx", "-q", "the quick brown fox"})
+
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.QueryText != "the quick brown fox" {
+		t.Errorf("Expected query text 'the quick brown fox', got %s", config.QueryText)
+	}
+
+	resetArgs([]string{"-c", "lookup", "-i", "index.idx", "-f", "-"})
+	config, err = ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.QueryFile != "-" {
+		t.Errorf("Expected query file '-', got %s", config.QueryFile)
+	}
+}
+
+// Test the hash command requires something to hash
+func TestParseFlags_HashCommand(t *testing.T) {
+	resetArgs([]string{"-c", "hash", "-q", "hello world"})
+	if _, err := ParseFlags(); err != nil {
+		t.Error(err)
+	}
+
+	resetArgs([]string{"-c", "hash"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for hash command without input, but found none")
+	}
+}
+
+// Test the feature set flags
+func TestParseFlags_Features(t *testing.T) {
+	resetArgs([]string{"-c", "index", "-i", "sample.txt", "-o", "index.idx", "--features", "ngram", "--ngram-n", "4"})
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.FeaturesSet {
+		t.Error("Expected FeaturesSet to be true when --features is given")
+	}
+	if f := config.Features(); f.FeatureSet != "ngram" || f.NgramN != 4 || f.NgramStep != 1 {
+		t.Errorf("Unexpected features %+v", f)
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "sample.txt", "-o", "index.idx", "--features", "shingle"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for an unknown feature set, but found none")
+	}
+}
+
+// Test the split flags of the index command
+func TestParseFlags_Split(t *testing.T) {
+	resetArgs([]string{"-c", "index", "-i", "sample.txt", "-o", "index.idx", "--split", "sentence", "--split-tolerance", "200"})
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := config.IndexOptions(); opts.Split != "sentence" || opts.Tolerance != 200 {
+		t.Errorf("Unexpected index options %+v", opts)
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "sample.txt", "-o", "index.idx", "--split", "line"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for an unknown split mode, but found none")
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "sample.txt", "-o", "index.idx", "--split", "cdc", "--min-size", "512", "--max-size", "8192"})
+	config, err = ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := config.IndexOptions(); opts.Split != "cdc" || opts.MinSize != 512 || opts.MaxSize != 8192 {
+		t.Errorf("Unexpected index options %+v", opts)
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "sample.txt", "-o", "index.idx", "-s", "1024", "--split", "cdc", "--max-size", "512"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for a max size below the chunk size, but found none")
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "sample.txt", "-o", "index.idx", "-s", "4096", "--stride", "1024"})
+	config, err = ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := config.IndexOptions(); opts.Stride != 1024 {
+		t.Errorf("Unexpected index options %+v", opts)
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "sample.txt", "-o", "index.idx", "--stride", "1024", "--split", "sentence"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for a stride with a boundary split, but found none")
+	}
+}
+
+// Test the directory walking flags of the index command
+func TestParseFlags_Walk(t *testing.T) {
+	resetArgs([]string{"-c", "index", "-i", "docs", "-o", "index.idx", "--include", "*.txt,*.pdf", "--exclude", "drafts", "--exclude", "*.tmp", "--follow-symlinks"})
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := config.WalkOptions()
+	if !slices.Equal(opts.Include, []string{"*.txt", "*.pdf"}) || !slices.Equal(opts.Exclude, []string{"drafts", "*.tmp"}) || !opts.FollowSymlinks {
+		t.Errorf("Unexpected walk options %+v", opts)
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "docs", "-o", "index.idx", "--exclude", "[z-"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for an invalid pattern, but found none")
+	}
+}
+
+// Test that merge takes the index files from -i and the arguments after the flags
+func TestParseFlags_Merge(t *testing.T) {
+	resetArgs([]string{"-c", "merge", "-o", "combined.idx", "a.idx", "b.idx"})
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.Indexes, []string{"a.idx", "b.idx"}) {
+		t.Errorf("Expected indexes [a.idx b.idx], got %v", config.Indexes)
+	}
+
+	resetArgs([]string{"-c", "merge", "-i", "a.idx", "-o", "combined.idx", "b.idx"})
+	config, err = ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.Indexes, []string{"a.idx", "b.idx"}) {
+		t.Errorf("Expected indexes [a.idx b.idx], got %v", config.Indexes)
+	}
+
+	resetArgs([]string{"-c", "merge", "a.idx", "b.idx"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for merge without -o, but found none")
+	}
+}
+
+// Test that remove needs an index and the files to remove
+func TestParseFlags_Remove(t *testing.T) {
+	resetArgs([]string{"-c", "remove", "-i", "index.idx", "--file", "docs/*.pdf"})
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.SourceFile != "docs/*.pdf" {
+		t.Errorf("Expected --file 'docs/*.pdf', got %s", config.SourceFile)
+	}
+
+	resetArgs([]string{"-c", "remove", "-i", "index.idx"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for remove without --file, but found none")
+	}
+}
+
+// Test that -i - indexes stdin under the --name label
+func TestParseFlags_Stdin(t *testing.T) {
+	resetArgs([]string{"-c", "index", "-i", "-", "--name", "dump.sql", "-o", "index.idx"})
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.IndexOptions().Name != "dump.sql" {
+		t.Errorf("Expected name 'dump.sql', got %s", config.IndexOptions().Name)
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "docs", "--name", "dump.sql", "-o", "index.idx"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for --name without -i -, but found none")
+	}
+	resetArgs([]string{"-c", "index", "-i", "-", "-o", "index.idx", "--update"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for --update with -i -, but found none")
+	}
+}
+
+func TestParseFlags_Type(t *testing.T) {
+	resetArgs([]string{"-c", "index", "-i", "server.log", "-o", "index.idx", "--type", "text"})
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.IndexOptions().Type != "text" {
+		t.Errorf("Expected type 'text', got %s", config.IndexOptions().Type)
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "server.log", "-o", "index.idx", "--type", "markdown"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for an unknown type, but found none")
+	}
+}
+
+func TestParseFlags_Encoding(t *testing.T) {
+	resetArgs([]string{"-c", "index", "-i", "letters/", "-o", "index.idx", "--encoding", "latin1"})
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.IndexOptions().Encoding != "latin1" || !config.ChunkingSet {
+		t.Errorf("Expected encoding 'latin1' given explicitly, got %q (%v)", config.IndexOptions().Encoding, config.ChunkingSet)
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "letters/", "-o", "index.idx", "--encoding", "shift_jis"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for an unsupported encoding, but found none")
+	}
+}
+
+func TestParseFlags_Records(t *testing.T) {
+	resetArgs([]string{"-c", "index", "-i", "customers.csv", "-o", "index.idx", "--split", "record", "--fields", "name,address", "--fields", "city", "--key", "id"})
+	config, err := ParseFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := config.IndexOptions()
+	if !slices.Equal(opts.Fields, []string{"name", "address", "city"}) || opts.Key != "id" || !config.ChunkingSet {
+		t.Errorf("Expected fields name,address,city and key id given explicitly, got %q, %q (%v)", opts.Fields, opts.Key, config.ChunkingSet)
+	}
+
+	resetArgs([]string{"-c", "index", "-i", "customers.csv", "-o", "index.idx", "--key", "id"})
+	if _, err := ParseFlags(); err == nil {
+		t.Error("Expected error for a key without record splits, but found none")
+	}
+}
@@ -0,0 +1,282 @@
+package internals
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	idx "github.com/bravian1/Textblitz/internals/indexer"
+	"github.com/bravian1/Textblitz/simhash"
+)
+
+const (
+	// IndexFormatVersion is the version of the index file layout written by Save: the
+	// binary format described in binindex.go. Version 1 was a bare gob-encoded IndexMap
+	// with no header, version 2 a gob-encoded IndexHeader followed by the IndexMap.
+	IndexFormatVersion = 3
+
+	// gobFormatVersion is the version recorded by SaveGob
+	gobFormatVersion = 2
+
+	// ToolVersion is the Textblitz version recorded in the indexes it writes
+	ToolVersion = "1.2.0"
+
+	// HashFunction names the fingerprint algorithm: 64-bit SimHash over FNV-1a feature hashes
+	HashFunction = "simhash64-fnv1a"
+
+	// ExtractorVersion is the version of the text extraction of PDF and Word documents,
+	// whose text the positions of their chunks point into. Version 1 extracts their pages
+	// and sections (see idx.PagedText); indexes that don't record a version extracted
+	// them with docconv, whose text differs.
+	ExtractorVersion = 1
+)
+
+// FeatureOptions selects how text is broken into features before it is hashed.
+// The zero value is the default: lowercased word features.
+type FeatureOptions struct {
+	FeatureSet    string // "word" (default) or "ngram"
+	NgramN        int    // n-gram size, ngram only (default 3)
+	NgramStep     int    // n-gram window step, ngram only (default 1)
+	CaseSensitive bool   // keep case instead of lowercasing the text first
+}
+
+// withDefaults fills in the defaults and clears settings that don't apply to the feature set
+func (f FeatureOptions) withDefaults() FeatureOptions {
+	f.FeatureSet = strings.ToLower(strings.TrimSpace(f.FeatureSet))
+	if f.FeatureSet == "" {
+		f.FeatureSet = "word"
+	}
+	if f.FeatureSet != "ngram" {
+		f.NgramN, f.NgramStep = 0, 0
+		return f
+	}
+	if f.NgramN <= 0 {
+		f.NgramN = 3
+	}
+	if f.NgramStep <= 0 {
+		f.NgramStep = 1
+	}
+	return f
+}
+
+// Validate checks the feature set name
+func (f FeatureOptions) Validate() error {
+	switch f.withDefaults().FeatureSet {
+	case "word", "ngram":
+		return nil
+	default:
+		return fmt.Errorf("unknown feature set %q (use word or ngram)", f.FeatureSet)
+	}
+}
+
+// NewFeatureSet builds the simhash feature set these options describe
+func (f FeatureOptions) NewFeatureSet() simhash.FeatureSet {
+	f = f.withDefaults()
+	if f.FeatureSet == "ngram" {
+		fs := simhash.NewNgramFeatureSet(f.NgramN, f.NgramStep)
+		fs.Normalize = !f.CaseSensitive
+		return fs
+	}
+	fs := simhash.NewWordFeatureSet()
+	fs.Normalize = !f.CaseSensitive
+	return fs
+}
+
+// Hash computes the SimHash of text with these feature options
+func (f FeatureOptions) Hash(text string) simhash.Fingerprint {
+	return simhash.Fingerprint(simhash.NewSimHashGenerator(f.NewFeatureSet()).Hash(text))
+}
+
+// String describes the options, e.g. "word" or "ngram (n=3, step=1), case-sensitive"
+func (f FeatureOptions) String() string {
+	f = f.withDefaults()
+	desc := f.FeatureSet
+	if f.FeatureSet == "ngram" {
+		desc = fmt.Sprintf("ngram (n=%d, step=%d)", f.NgramN, f.NgramStep)
+	}
+	if f.CaseSensitive {
+		desc += ", case-sensitive"
+	}
+	return desc
+}
+
+// IndexHeader describes how an index was built. It is written at the start of
+// every index file so lookups can hash query text exactly the way the chunks were hashed.
+type IndexHeader struct {
+	FormatVersion int    // layout version of the index file, see IndexFormatVersion
+	ToolVersion   string // Textblitz version that wrote the file
+	ChunkSize     int    // chunk size in bytes
+	FeatureSet    string // "word" or "ngram"; empty if unknown (index written without a header)
+	NgramN        int    // n-gram size (ngram only)
+	NgramStep     int    // n-gram window step (ngram only)
+	Normalize     bool   // text was lowercased before feature extraction
+	HashFunction  string // fingerprint algorithm, see HashFunction
+
+	Split          string   // how chunks were cut: "bytes", "word", "sentence", "paragraph", "cdc" or "record"; empty means bytes
+	SplitTolerance int      // how far a chunk could end from ChunkSize to reach a boundary (boundary splits only)
+	MinSize        int      // smallest chunk (cdc only; ChunkSize is the average)
+	MaxSize        int      // largest chunk (cdc only)
+	Stride         int      // bytes between the starts of overlapping chunks, 0 if they don't overlap
+	Type           string   // type every input was read as, if it was given rather than detected; see idx.ParseType
+	Encoding       string   // encoding text was read in, if it was given rather than detected; see idx.ParseEncoding
+	Fields         []string // columns or fields whose values were hashed, nil for all (record split only)
+	Key            string   // column or field whose value identifies each record (record split only)
+	Extractor      int      // how the text of PDF and Word documents was extracted, see ExtractorVersion
+}
+
+// NewIndexHeader returns the header for an index built with opts
+func NewIndexHeader(opts IndexOptions) IndexHeader {
+	features := opts.Features.withDefaults()
+	header := IndexHeader{
+		FormatVersion: IndexFormatVersion,
+		ToolVersion:   ToolVersion,
+		ChunkSize:     opts.ChunkSize,
+		FeatureSet:    features.FeatureSet,
+		NgramN:        features.NgramN,
+		NgramStep:     features.NgramStep,
+		Normalize:     !features.CaseSensitive,
+		HashFunction:  HashFunction,
+
+		Split:          opts.split(),
+		SplitTolerance: opts.splitTolerance(),
+		Stride:         opts.stride(),
+		Type:           string(opts.readOptions().Type),
+		Encoding:       opts.encoding(),
+		Fields:         opts.recordOptions().Fields,
+		Key:            opts.recordOptions().Key,
+		Extractor:      ExtractorVersion,
+	}
+	if cdc, ok := opts.splitter().(idx.CDCSplitter); ok {
+		header.MinSize, header.MaxSize = cdc.Min, cdc.Max
+	}
+	return header
+}
+
+// Known reports whether the header records how the index was hashed.
+// Indexes written before headers existed load with an empty header.
+func (h IndexHeader) Known() bool {
+	return h.FeatureSet != ""
+}
+
+// Features returns the feature options the index was built with.
+// For an index without a header that is the default (word features), which is
+// what every index was built with before the feature set became configurable.
+func (h IndexHeader) Features() FeatureOptions {
+	if !h.Known() {
+		return FeatureOptions{}
+	}
+	return FeatureOptions{
+		FeatureSet:    h.FeatureSet,
+		NgramN:        h.NgramN,
+		NgramStep:     h.NgramStep,
+		CaseSensitive: !h.Normalize,
+	}.withDefaults()
+}
+
+// CheckFeatures returns an error if text hashed with f would not be comparable
+// with the index. Unknown headers can't be checked and always pass.
+func (h IndexHeader) CheckFeatures(f FeatureOptions) error {
+	if !h.Known() {
+		return nil
+	}
+	if h.HashFunction != "" && h.HashFunction != HashFunction {
+		return fmt.Errorf("index was hashed with %s, this version only supports %s", h.HashFunction, HashFunction)
+	}
+	if want, got := h.Features(), f.withDefaults(); want != got {
+		return fmt.Errorf("query would be hashed with %s features but the index was built with %s features", got, want)
+	}
+	return nil
+}
+
+// IndexOptions returns opts with the chunking and feature options replaced by the ones
+// the index was built with, so that more text can be indexed the same way
+func (h IndexHeader) IndexOptions(opts IndexOptions) IndexOptions {
+	opts.ChunkSize = h.ChunkSize
+	opts.Features = h.Features()
+	opts.Split = h.Split
+	opts.Tolerance = h.SplitTolerance
+	opts.MinSize = h.MinSize
+	opts.MaxSize = h.MaxSize
+	opts.Stride = h.Stride
+	opts.Type = h.Type
+	opts.Encoding = h.Encoding
+	opts.Fields = slices.Clone(h.Fields)
+	opts.Key = h.Key
+	return opts
+}
+
+// ReadOptions returns the type and encoding the sources of the index were read as, so
+// their chunks can be read back the same way (see idx.ChunkReader)
+func (h IndexHeader) ReadOptions() idx.ReadOptions {
+	return h.IndexOptions(IndexOptions{}).readOptions()
+}
+
+// CheckSource returns an error if the chunks of file can't be read back from it: those of
+// a PDF or Word document indexed with an older text extraction (see ExtractorVersion)
+func (h IndexHeader) CheckSource(file string) error {
+	if h.Extractor < ExtractorVersion && idx.IsDocument(file) {
+		return fmt.Errorf("%s was indexed from text extracted by an older version; rebuild the index to use it", file)
+	}
+	return nil
+}
+
+// CheckChunking returns an error if text indexed with opts would not be chunked and
+// hashed the way the index was, so its entries could not be mixed with the index's
+func (h IndexHeader) CheckChunking(opts IndexOptions) error {
+	return h.CheckCompatible(NewIndexHeader(opts))
+}
+
+// CheckCompatible returns an error if the index described by other was chunked or
+// hashed differently, so the entries of the two indexes could not be mixed
+func (h IndexHeader) CheckCompatible(other IndexHeader) error {
+	if h.HashFunction != other.HashFunction {
+		return fmt.Errorf("the index was hashed with %s, not %s", h.HashFunction, other.HashFunction)
+	}
+	if want, got := h.chunking(), other.chunking(); want != got {
+		return fmt.Errorf("the index was chunked with %s, not %s", want, got)
+	}
+	if want, got := h.Features(), other.Features(); want != got {
+		return fmt.Errorf("the index was built with %s features, not %s", want, got)
+	}
+	return nil
+}
+
+// chunking describes how the text of the index was read and cut into chunks
+func (h IndexHeader) chunking() string {
+	split := h.Split
+	if split == "" {
+		split = "bytes"
+	}
+	desc := fmt.Sprintf("chunk size %d, split %s", h.ChunkSize, split)
+	if h.SplitTolerance > 0 {
+		desc += fmt.Sprintf(", tolerance %d", h.SplitTolerance)
+	}
+	if h.MinSize > 0 || h.MaxSize > 0 {
+		desc += fmt.Sprintf(", sizes %d-%d", h.MinSize, h.MaxSize)
+	}
+	if h.Stride > 0 {
+		desc += fmt.Sprintf(", stride %d", h.Stride)
+	}
+	if h.Type != "" {
+		desc += ", type " + h.Type
+	}
+	if h.Encoding != "" {
+		desc += ", encoding " + h.Encoding
+	}
+	if len(h.Fields) > 0 {
+		desc += fmt.Sprintf(", fields %q", h.Fields)
+	}
+	if h.Key != "" {
+		desc += ", key " + h.Key
+	}
+	return desc
+}
+
+// checkVersion returns an error for index files written by a newer, incompatible version
+func (h IndexHeader) checkVersion() error {
+	if h.FormatVersion > IndexFormatVersion {
+		return fmt.Errorf("index format version %d is newer than this tool supports (%d); written by Textblitz %s",
+			h.FormatVersion, IndexFormatVersion, h.ToolVersion)
+	}
+	return nil
+}
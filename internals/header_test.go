@@ -0,0 +1,225 @@
+package internals
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	idx "github.com/bravian1/Textblitz/internals/indexer"
+)
+
+// Test that the header written by Save comes back from Load
+func TestIndexManager_HeaderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.idx")
+	features := FeatureOptions{FeatureSet: "ngram", NgramN: 4, NgramStep: 2, CaseSensitive: true}
+
+	im := NewIndexManager()
+	im.SetHeader(NewIndexHeader(IndexOptions{ChunkSize: 2048, Features: features, Encoding: "latin1"}))
+	im.Add("42", IndexEntry{OriginalFile: "a.txt", Size: 2048})
+	if err := im.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewIndexManager()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	header := loaded.Header()
+	if header.FormatVersion != IndexFormatVersion || header.ToolVersion != ToolVersion || header.HashFunction != HashFunction {
+		t.Errorf("unexpected versions in header: %+v", header)
+	}
+	if header.ChunkSize != 2048 {
+		t.Errorf("Expected chunk size 2048, got %d", header.ChunkSize)
+	}
+	if header.Features() != features {
+		t.Errorf("Expected features %s, got %s", features, header.Features())
+	}
+	if header.Encoding != "iso-8859-1" {
+		t.Errorf("Expected encoding iso-8859-1, got %q", header.Encoding)
+	}
+	if header.Extractor != ExtractorVersion {
+		t.Errorf("Expected extractor version %d, got %d", ExtractorVersion, header.Extractor)
+	}
+	if len(loaded.EntriesAt("a.txt", 0)) != 1 {
+		t.Error("Expected the entry to survive the round trip")
+	}
+}
+
+// Test that an index written before the header existed still loads, with an unknown header
+func TestIndexManager_LoadLegacyIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.idx")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := IndexMap{"42": {{OriginalFile: "a.txt", Size: 4096}}}
+	if err := gob.NewEncoder(file).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	im := NewIndexManager()
+	if err := im.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if im.Header().Known() {
+		t.Errorf("Expected an unknown header, got %+v", im.Header())
+	}
+	if len(im.EntriesAt("a.txt", 0)) != 1 {
+		t.Error("Expected the legacy entry to load")
+	}
+	if im.HashText("hello world") != (FeatureOptions{}).Hash("hello world") {
+		t.Error("Expected a legacy index to hash text with the default features")
+	}
+}
+
+// Test that a file from a newer format version is refused
+func TestIndexManager_LoadNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "future.idx")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder := gob.NewEncoder(file)
+	encoder.Encode(IndexHeader{FormatVersion: IndexFormatVersion + 1, ToolVersion: "9.0.0", FeatureSet: "word"})
+	encoder.Encode(IndexMap{})
+	file.Close()
+
+	if err := NewIndexManager().Load(path); err == nil {
+		t.Error("Expected an error for a newer index format, but found none")
+	}
+}
+
+// Test that the default feature options hash text the way the worker pool hashes chunks
+func TestFeatureOptions_HashMatchesWorkerPool(t *testing.T) {
+	text := "The quick brown fox jumps over the lazy dog"
+
+	pool := idx.NewSimHashWorkerPool(1)
+	pool.Start()
+	pool.Submit(idx.Task{ID: 1, Data: []byte(text)})
+	result := <-pool.Results()
+	pool.Stop()
+
+	if got := (FeatureOptions{}).Hash(text); uint64(got) != result.Hash {
+		t.Errorf("Hash() = %d, worker pool hashed %d", got, result.Hash)
+	}
+}
+
+// Test that query features are checked against the header
+func TestIndexHeader_CheckFeatures(t *testing.T) {
+	header := NewIndexHeader(IndexOptions{ChunkSize: 4096, Features: FeatureOptions{FeatureSet: "ngram"}})
+
+	if err := header.CheckFeatures(FeatureOptions{FeatureSet: "ngram", NgramN: 3, NgramStep: 1}); err != nil {
+		t.Errorf("Expected matching features to pass, got %v", err)
+	}
+	if err := header.CheckFeatures(FeatureOptions{}); err == nil {
+		t.Error("Expected an error for word features against an ngram index, but found none")
+	}
+	if err := header.CheckFeatures(FeatureOptions{FeatureSet: "ngram", NgramN: 5}); err == nil {
+		t.Error("Expected an error for a different n-gram size, but found none")
+	}
+	if err := (IndexHeader{}).CheckFeatures(FeatureOptions{FeatureSet: "ngram"}); err != nil {
+		t.Errorf("Expected an unknown header to pass, got %v", err)
+	}
+}
+
+// Test that options are compared with the chunking and features the index was built with
+func TestIndexHeader_CheckChunking(t *testing.T) {
+	opts := IndexOptions{ChunkSize: 1024, Split: "cdc", Features: FeatureOptions{FeatureSet: "ngram", NgramN: 4}}
+	header := NewIndexHeader(opts)
+
+	if err := header.CheckChunking(header.IndexOptions(IndexOptions{Workers: 8})); err != nil {
+		t.Errorf("Expected the header's own options to pass, got %v", err)
+	}
+
+	changed := []IndexOptions{
+		{ChunkSize: 2048, Split: "cdc", Features: opts.Features},
+		{ChunkSize: 1024, Split: "cdc", MaxSize: 2048, Features: opts.Features},
+		{ChunkSize: 1024, Split: "bytes", Features: opts.Features},
+		{ChunkSize: 1024, Split: "cdc"},
+		{ChunkSize: 1024, Split: "cdc", Features: opts.Features, Encoding: "utf-16le"},
+		{ChunkSize: 1024, Split: "cdc", Features: opts.Features, Type: "text"},
+	}
+	for _, other := range changed {
+		if err := header.CheckChunking(other); err == nil {
+			t.Errorf("Expected an error for %+v, but found none", other)
+		}
+	}
+}
+
+// Test that record splits remember the fields they hashed and the key of their records
+func TestIndexHeader_Records(t *testing.T) {
+	opts := IndexOptions{ChunkSize: 4096, Split: "record", Fields: []string{" name", "address "}, Key: "id"}
+	header := NewIndexHeader(opts)
+	if header.Split != "record" || !slices.Equal(header.Fields, []string{"name", "address"}) || header.Key != "id" {
+		t.Fatalf("unexpected header %+v", header)
+	}
+
+	again := header.IndexOptions(IndexOptions{})
+	if err := header.CheckChunking(again); err != nil {
+		t.Errorf("Expected the header's own options to pass, got %v", err)
+	}
+	for _, other := range []IndexOptions{
+		{ChunkSize: 4096, Split: "record", Fields: []string{"name"}, Key: "id"},
+		{ChunkSize: 4096, Split: "record", Fields: []string{"name", "address"}},
+	} {
+		if err := header.CheckChunking(other); err == nil {
+			t.Errorf("Expected an error for %+v, but found none", other)
+		}
+	}
+}
+
+// Test that hashed fields holding commas come back whole from a saved index
+func TestIndexHeader_FieldsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.idx")
+	fields := []string{"name, first", "address"}
+	im := NewIndexManager()
+	im.SetHeader(NewIndexHeader(IndexOptions{ChunkSize: 4096, Split: "record", Fields: fields, Key: "id"}))
+	im.Add("42", IndexEntry{OriginalFile: "people.csv", Size: 4096})
+	if err := im.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewIndexManager()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Header().IndexOptions(IndexOptions{}).Fields; !slices.Equal(got, fields) {
+		t.Errorf("Expected fields %q, got %q", fields, got)
+	}
+}
+
+// Test that documents indexed with an older text extraction can't be read back, updated or merged
+func TestIndexHeader_OldExtractor(t *testing.T) {
+	header := NewIndexHeader(IndexOptions{ChunkSize: 1024})
+	header.Extractor = 0
+
+	if err := header.CheckSource("notes.txt"); err != nil {
+		t.Errorf("Expected text to read back, got %v", err)
+	}
+	if err := header.CheckSource("docs.zip!/report.DOCX"); err == nil {
+		t.Error("Expected an error for a Word document extracted the old way")
+	}
+
+	old := NewIndexManager()
+	old.SetHeader(header)
+	old.Add("42", IndexEntry{OriginalFile: "report.pdf", Size: 1024})
+	if _, err := old.UpdateFiles(context.Background(), []string{"report.pdf"}, IndexOptions{}); err == nil {
+		t.Error("Expected updating the index to fail")
+	}
+	merged := NewIndexManager()
+	if _, err := merged.Merge(old); err == nil {
+		t.Error("Expected merging the index to fail")
+	}
+
+	// an index of text only is fine, and is brought up to date
+	text := NewIndexManager()
+	text.SetHeader(header)
+	text.Add("42", IndexEntry{OriginalFile: "notes.txt", Size: 1024})
+	if _, err := merged.Merge(text); err != nil || merged.Header().Extractor != ExtractorVersion {
+		t.Errorf("Expected the text index to merge with extractor version %d, got %d, %v", ExtractorVersion, merged.Header().Extractor, err)
+	}
+}
@@ -0,0 +1,274 @@
+package indexer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// MemberSeparator separates an archive from the path of a file inside it in the
+// names chunks are labelled with, as in "bundle.zip!/docs/a.txt"
+const MemberSeparator = "!/"
+
+// errFound stops the walk over an archive once the wanted member has been read
+var errFound = errors.New("member found")
+
+// compression returns the decompressor for a file compressed with gzip (.gz), bzip2 (.bz2)
+// or xz (.xz), and the name of the file once decompressed. .tgz, .tbz2 and .txz are
+// compressed tar archives. ok is false for a file that isn't compressed.
+func compression(name string) (open func(io.Reader) (io.Reader, error), inner string, ok bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	switch ext {
+	case ".gz", ".tgz":
+		open = func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }
+	case ".bz2", ".tbz2":
+		open = func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil }
+	case ".xz", ".txz":
+		open = func(r io.Reader) (io.Reader, error) { return xz.NewReader(r) }
+	default:
+		return nil, name, false
+	}
+	inner = strings.TrimSuffix(name, filepath.Ext(name))
+	if ext != ".gz" && ext != ".bz2" && ext != ".xz" {
+		inner += ".tar"
+	}
+	return open, inner, true
+}
+
+// uncompressedName returns the name of a file once decompressed
+func uncompressedName(name string) string {
+	for {
+		_, inner, ok := compression(name)
+		if !ok {
+			return name
+		}
+		name = inner
+	}
+}
+
+// archiveKind returns ".zip" or ".tar" for the names of the archives WalkText can read,
+// and "" for anything else. Tar archives may be compressed; zip archives can't.
+func archiveKind(name string) string {
+	if strings.ToLower(filepath.Ext(name)) == ".zip" {
+		return ".zip"
+	}
+	if strings.ToLower(filepath.Ext(uncompressedName(name))) == ".tar" {
+		return ".tar"
+	}
+	return ""
+}
+
+// IsArchive reports whether filename is a .zip or .tar archive (.tar.gz, .tgz, .tar.bz2,
+// .tar.xz, ...), whose files are indexed one by one with WalkText
+func IsArchive(filename string) bool {
+	return archiveKind(filename) != ""
+}
+
+// SplitMember splits the name of a file inside an archive ("bundle.zip!/docs/a.txt")
+// into the archive and the path of the file inside it. ok is false for other names.
+// The archive is named by its extension, or is an existing file whose content said
+// it is an archive when it was indexed.
+func SplitMember(name string) (archive, member string, ok bool) {
+	for i := 0; i < len(name); {
+		j := strings.Index(name[i:], MemberSeparator)
+		if j < 0 {
+			break
+		}
+		i += j
+		if IsArchive(name[:i]) || isFile(name[:i]) {
+			return name[:i], name[i+len(MemberSeparator):], true
+		}
+		i += len(MemberSeparator)
+	}
+	return "", "", false
+}
+
+// WalkText calls fn with the name and a reader over the text of the input read from r.
+// name is the name of the input; opts overrides its detected type and encoding.
+//
+// The input is decompressed if it is compressed. An archive calls fn for every file in
+// it ("bundle.zip!/docs/a.txt") that Supported accepts, in archive order, each file's
+// type detected on its own; directories, links, archives inside the archive and files
+// that aren't text are skipped, the last passed to onSkip, if it is set, with what gave
+// them away. Tar archives are read as a stream; zip archives are read in place if r is
+// a file, and into memory otherwise. Input that isn't text returns a *BinaryError.
+func WalkText(r io.Reader, name string, opts ReadOptions, onSkip func(name, reason string), fn func(name string, text io.Reader) error) error {
+	d, err := openDocument(r, name, opts)
+	if err != nil {
+		return err
+	}
+	if d.typ != TypeZip && d.typ != TypeTar {
+		text, err := d.text()
+		if err != nil {
+			return err
+		}
+		return fn(name, text)
+	}
+
+	return eachMember(d, func(member string, data io.Reader) error {
+		if !Supported(member) || IsArchive(member) {
+			return nil
+		}
+		full := name + MemberSeparator + member
+		md, err := openDocument(data, full, ReadOptions{Encoding: opts.Encoding})
+		if err != nil {
+			return err
+		}
+		if md.typ == TypeBinary && onSkip != nil {
+			onSkip(full, md.reason)
+		}
+		if md.typ == TypeZip || md.typ == TypeTar || md.typ == TypeBinary {
+			return nil
+		}
+		text, err := md.text()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", full, err)
+		}
+		return fn(full, text)
+	})
+}
+
+// eachMember calls fn with the path and contents of every regular file in the zip or
+// tar archive d, until fn returns an error
+func eachMember(d *document, fn func(member string, data io.Reader) error) error {
+	switch d.typ {
+	case TypeZip:
+		zr, err := d.zip()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", d.name, err)
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			data, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("failed to read %s%s%s: %w", d.name, MemberSeparator, f.Name, err)
+			}
+			err = fn(cleanMember(f.Name), data)
+			data.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case TypeTar:
+		tr := tar.NewReader(d.r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", d.name, err)
+			}
+			if !header.FileInfo().Mode().IsRegular() {
+				continue
+			}
+			if err := fn(cleanMember(header.Name), tr); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("%s is not a zip or tar archive", d.name)
+	}
+}
+
+// zipReader opens a zip archive read from r. Zip archives are read from their end,
+// so anything but a file is read into memory first.
+func zipReader(r io.Reader) (*zip.Reader, error) {
+	if file, ok := r.(*os.File); ok {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return zip.NewReader(file, info.Size())
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// cleanMember returns the path of an archive member without "./" or leading slashes
+func cleanMember(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// openMember returns the text of a file inside an archive on disk, see memberDocument
+func openMember(archive, member string, opts ReadOptions) (io.ReadCloser, error) {
+	d, err := memberDocument(archive, member, opts)
+	if err != nil {
+		return nil, err
+	}
+	text, err := d.text()
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(text), nil
+}
+
+// memberDocument opens a file inside an archive on disk. opts overrides the detected
+// type and encoding of the file. The file is held in memory, since a tar archive can only
+// be read from its start.
+func memberDocument(archive, member string, opts ReadOptions) (*document, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	d, err := openDocument(file, archive, ReadOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	member = cleanMember(member)
+	var data []byte
+	err = eachMember(d, func(name string, r io.Reader) error {
+		if name != member {
+			return nil
+		}
+		if data, err = io.ReadAll(r); err != nil {
+			return err
+		}
+		return errFound
+	})
+	switch {
+	case err == errFound:
+		return openDocument(bytes.NewReader(data), archive+MemberSeparator+member, opts)
+	case err != nil:
+		return nil, err
+	default:
+		return nil, fmt.Errorf("%s has no file %s", archive, member)
+	}
+}
+
+// isFile reports whether name is an existing regular file
+func isFile(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// readCloser is a reader over the text of a file that closes the file when done
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc readCloser) Close() error {
+	return rc.close()
+}
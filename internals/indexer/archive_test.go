@@ -0,0 +1,234 @@
+package indexer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+// archiveFiles are the files put into the test archives, in order
+var archiveFiles = []struct{ name, text string }{
+	{"docs/a.txt", "the first file"},
+	{"docs/notes.md", "not indexed"},
+	{"./b.txt", "the second file"},
+	{"c.txt.gz", "compressed inside the archive"},
+	{"tool", "\x7fELF\x02\x01\x01\x00\x00\x00"},
+}
+
+func gzipped(t *testing.T, text string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, text); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// contents returns what is stored in an archive for file: compressed for a .gz file
+func contents(t *testing.T, name, text string) []byte {
+	if strings.HasSuffix(name, ".gz") {
+		return gzipped(t, text)
+	}
+	return []byte(text)
+}
+
+func makeZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if _, err := zw.Create("docs/"); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range archiveFiles {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(contents(t, f.name, f.text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeTar(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "docs/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range archiveFiles {
+		data := contents(t, f.name, f.text)
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "link.txt", Typeflag: tar.TypeSymlink, Linkname: "b.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Test that every readable file of zip and tar archives is walked, with its text
+func TestWalkText_Archive(t *testing.T) {
+	dir := t.TempDir()
+	archives := map[string][]byte{
+		"bundle.zip":    makeZip(t),
+		"bundle.tar":    makeTar(t),
+		"bundle.tar.gz": gzipped(t, string(makeTar(t))),
+		"bundle.tgz":    gzipped(t, string(makeTar(t))),
+	}
+	for name, data := range archives {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			path + "!/docs/a.txt", "the first file",
+			path + "!/b.txt", "the second file",
+			path + "!/c.txt.gz", "compressed inside the archive",
+		}
+
+		for _, input := range []string{"file", "stream"} {
+			var r io.Reader = bytes.NewReader(data)
+			if input == "file" {
+				file, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+				r = file
+			}
+			var got, skipped []string
+			onSkip := func(member, reason string) {
+				skipped = append(skipped, member+": "+reason)
+			}
+			err := WalkText(r, path, ReadOptions{}, onSkip, func(member string, text io.Reader) error {
+				data, err := io.ReadAll(text)
+				got = append(got, member, string(data))
+				return err
+			})
+			if err != nil {
+				t.Fatalf("%s (%s): %v", name, input, err)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("%s (%s): expected %q, got %q", name, input, want, got)
+			}
+			if want := path + "!/tool: NUL byte at offset 7"; len(skipped) != 1 || skipped[0] != want {
+				t.Errorf("%s (%s): expected %q to be skipped, got %q", name, input, want, skipped)
+			}
+		}
+
+		// a file inside the archive reads back through OpenText and ChunkReader
+		text, err := ReadText(path + "!/b.txt")
+		if err != nil || string(text) != "the second file" {
+			t.Errorf("%s: expected the text of b.txt, got %q, %v", name, text, err)
+		}
+		excerpt, err := NewChunkReader().Read(path+"!/c.txt.gz", 4, 10, 4)
+		if err != nil || string(excerpt.Before) != "comp" || string(excerpt.Text) != "ressed ins" || string(excerpt.After) != "ide " {
+			t.Errorf("%s: unexpected excerpt %q, %v", name, excerpt, err)
+		}
+		if _, err := OpenText(path + "!/missing.txt"); err == nil {
+			t.Errorf("%s: expected error for a missing file, but found none", name)
+		}
+	}
+}
+
+// Test that compressed files are decompressed as they are read
+func TestOpenText_Compressed(t *testing.T) {
+	dir := t.TempDir()
+	var xzData bytes.Buffer
+	xw, err := xz.NewWriter(&xzData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(xw, "packed with xz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"a.txt.gz": gzipped(t, "packed with gzip"),
+		"b.txt.xz": xzData.Bytes(),
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if !Supported(path) {
+			t.Errorf("Expected %s to be supported", name)
+		}
+		file, err := OpenText(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := io.ReadAll(file)
+		file.Close()
+		if err != nil || !strings.HasPrefix(string(text), "packed with ") {
+			t.Errorf("%s: unexpected text %q, %v", name, text, err)
+		}
+	}
+
+	// compressed binary content is told apart once decompressed
+	path := filepath.Join(dir, "image.gz")
+	if err := os.WriteFile(path, gzipped(t, "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var binary *BinaryError
+	if _, err := OpenText(path); !errors.As(err, &binary) {
+		t.Errorf("Expected a BinaryError, got %v", err)
+	}
+}
+
+func TestSplitMember(t *testing.T) {
+	tests := []struct {
+		name, archive, member string
+		ok                    bool
+	}{
+		{"bundle.zip!/docs/a.txt", "bundle.zip", "docs/a.txt", true},
+		{"dir!/x/bundle.tar.gz!/a.txt", "dir!/x/bundle.tar.gz", "a.txt", true},
+		{"docs/a.txt", "", "", false},
+		{"wow!/a.txt", "", "", false},
+	}
+	for _, tt := range tests {
+		archive, member, ok := SplitMember(tt.name)
+		if archive != tt.archive || member != tt.member || ok != tt.ok {
+			t.Errorf("SplitMember(%q) = %q, %q, %v; want %q, %q, %v", tt.name, archive, member, ok, tt.archive, tt.member, tt.ok)
+		}
+	}
+
+	for name, want := range map[string]bool{
+		"a.zip": true, "a.tar": true, "a.tar.gz": true, "a.tgz": true, "a.tar.bz2": true, "a.txz": true,
+		"a.txt.gz": false, "a.gz": false, "a.txt": false,
+	} {
+		if IsArchive(name) != want {
+			t.Errorf("IsArchive(%q) = %v, want %v", name, !want, want)
+		}
+	}
+}
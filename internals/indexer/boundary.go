@@ -0,0 +1,140 @@
+package indexer
+
+import (
+	"fmt"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Boundary is the kind of text edge a BoundarySplitter ends its chunks on
+type Boundary int
+
+const (
+	WordBoundary      Boundary = iota + 1 // between words
+	SentenceBoundary                      // between sentences, see sentenceBoundaries
+	ParagraphBoundary                     // after a blank line
+)
+
+// boundaryLookahead is how far past a candidate cut the splitter reads, so that
+// deciding whether a position is a sentence boundary can see the text that follows it
+const boundaryLookahead = 64
+
+// BoundarySplitter cuts text into chunks of about Size bytes that end on a word,
+// sentence or paragraph boundary.
+//
+// Each chunk ends at the boundary closest to Size bytes, as long as that is no more
+// than Tolerance bytes away. If no boundary is in range, the chunk is cut at Size bytes,
+// moved back to the start of a UTF-8 character so that no character is ever split.
+// A chunk starts where the previous one ended, so chunks hold the whitespace between
+// them and still add up to the whole input.
+type BoundarySplitter struct {
+	Size      int
+	Boundary  Boundary
+	Tolerance int // 0 means Size/4
+}
+
+// Split implements Splitter
+func (s BoundarySplitter) Split(r io.Reader, emit func(offset int, data []byte) error) error {
+	if s.Size <= 0 {
+		return fmt.Errorf("invalid chunk size: %d", s.Size)
+	}
+	tolerance := s.tolerance()
+	window := s.Size + tolerance + boundaryLookahead
+
+	return splitWindows(r, window, func(buf []byte, eof bool) int {
+		if eof && len(buf) <= s.Size+tolerance {
+			return len(buf)
+		}
+		return s.cut(buf, tolerance)
+	}, emit)
+}
+
+func (s BoundarySplitter) tolerance() int {
+	if s.Tolerance > 0 {
+		return s.Tolerance
+	}
+	return s.Size / 4
+}
+
+// cut returns where the next chunk of buf ends
+func (s BoundarySplitter) cut(buf []byte, tolerance int) int {
+	best := -1
+	for _, b := range s.boundaries(buf) {
+		if b <= 0 || b < s.Size-tolerance || b > s.Size+tolerance {
+			continue
+		}
+		if best < 0 || abs(b-s.Size) < abs(best-s.Size) {
+			best = b
+		}
+	}
+	if best > 0 {
+		return best
+	}
+	return runeCut(buf, min(s.Size, len(buf)))
+}
+
+// boundaries returns the positions in text where a chunk may end
+func (s BoundarySplitter) boundaries(text []byte) []int {
+	switch s.Boundary {
+	case WordBoundary:
+		return wordBoundaries(text)
+	case SentenceBoundary:
+		return sentenceBoundaries(text)
+	case ParagraphBoundary:
+		return paragraphBoundaries(text)
+	default:
+		return nil
+	}
+}
+
+// runeCut moves a cut at n back to the start of the UTF-8 character it falls in
+func runeCut(buf []byte, n int) int {
+	for p := n; p > 0 && n-p < utf8.UTFMax; p-- {
+		if p == len(buf) || utf8.RuneStart(buf[p]) {
+			return p
+		}
+	}
+	return n
+}
+
+// wordBoundaries returns the start of every word that follows whitespace
+func wordBoundaries(text []byte) []int {
+	var bounds []int
+	prevSpace := false
+	for i, r := range string(text) {
+		space := unicode.IsSpace(r)
+		if prevSpace && !space {
+			bounds = append(bounds, i)
+		}
+		prevSpace = space
+	}
+	return bounds
+}
+
+// paragraphBoundaries returns the start of every paragraph that follows a blank line
+func paragraphBoundaries(text []byte) []int {
+	var bounds []int
+	newlines := 0
+	for i, r := range string(text) {
+		switch {
+		case r == '\n':
+			newlines++
+		case unicode.IsSpace(r):
+			// spaces and carriage returns on a blank line don't end it
+		default:
+			if newlines >= 2 {
+				bounds = append(bounds, i)
+			}
+			newlines = 0
+		}
+	}
+	return bounds
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
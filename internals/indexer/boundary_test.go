@@ -0,0 +1,129 @@
+package indexer
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+type chunk struct {
+	offset int
+	data   string
+}
+
+func splitAll(t *testing.T, s Splitter, text string) []chunk {
+	t.Helper()
+	var chunks []chunk
+	err := s.Split(strings.NewReader(text), func(offset int, data []byte) error {
+		chunks = append(chunks, chunk{offset, string(data)})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// chunks always add up to the input, with offsets that follow on from each other
+	var joined strings.Builder
+	for _, c := range chunks {
+		if c.offset != joined.Len() {
+			t.Fatalf("chunk at offset %d, expected %d", c.offset, joined.Len())
+		}
+		joined.WriteString(c.data)
+	}
+	if joined.String() != text {
+		t.Fatal("chunks don't add up to the input")
+	}
+	return chunks
+}
+
+func jungleBook(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile("../../testdata/jungle_book_by_kipling.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data[:100_000])
+}
+
+// TestBoundarySplitter_Word checks that words are never cut in half
+func TestBoundarySplitter_Word(t *testing.T) {
+	text := jungleBook(t)
+	splitter := BoundarySplitter{Size: 1000, Boundary: WordBoundary, Tolerance: 100}
+
+	chunks := splitAll(t, splitter, text)
+	for _, c := range chunks[:len(chunks)-1] {
+		last, _ := utf8.DecodeLastRuneInString(c.data)
+		if !unicode.IsSpace(last) {
+			t.Errorf("chunk at %d ends inside a word: %q", c.offset, c.data[len(c.data)-20:])
+		}
+		if len(c.data) < 900 || len(c.data) > 1100 {
+			t.Errorf("chunk at %d is %d bytes, outside the tolerance", c.offset, len(c.data))
+		}
+	}
+}
+
+// TestBoundarySplitter_Sentence checks that chunks end where sentences end
+func TestBoundarySplitter_Sentence(t *testing.T) {
+	text := jungleBook(t)
+	splitter := BoundarySplitter{Size: 2000, Boundary: SentenceBoundary}
+
+	starts := make(map[int]bool)
+	for _, b := range sentenceBoundaries([]byte(text)) {
+		starts[b] = true
+	}
+	inRange := 0
+	chunks := splitAll(t, splitter, text)
+	for _, c := range chunks[1:] {
+		if starts[c.offset] {
+			inRange++
+		}
+	}
+	// a few chunks may have no sentence end within 500 bytes of the target
+	if inRange < len(chunks)*9/10 {
+		t.Errorf("only %d of %d chunks start a sentence", inRange, len(chunks))
+	}
+}
+
+// TestBoundarySplitter_Paragraph checks that chunks start at paragraphs
+func TestBoundarySplitter_Paragraph(t *testing.T) {
+	text := strings.Repeat("A short paragraph of text.\n\nAnother one, a little bit longer than that.\n\n", 50)
+	chunks := splitAll(t, BoundarySplitter{Size: 300, Boundary: ParagraphBoundary}, text)
+	for _, c := range chunks[:len(chunks)-1] {
+		if !strings.HasSuffix(c.data, "\n\n") {
+			t.Errorf("chunk at %d doesn't end on a blank line: %q", c.offset, c.data)
+		}
+	}
+}
+
+// TestBoundarySplitter_Runes checks the fallback cut when no boundary is in range
+func TestBoundarySplitter_Runes(t *testing.T) {
+	text := strings.Repeat("狼来了", 500) // no spaces at all, 3 bytes per character
+	chunks := splitAll(t, BoundarySplitter{Size: 100, Boundary: WordBoundary}, text)
+	for _, c := range chunks {
+		if !utf8.ValidString(c.data) {
+			t.Fatalf("chunk at %d cuts a character: %q", c.offset, c.data)
+		}
+		if len(c.data) > 100 {
+			t.Errorf("chunk at %d is %d bytes, expected at most 100", c.offset, len(c.data))
+		}
+	}
+}
+
+// TestBoundarySplitter_Streams checks that the splitter only reads a window ahead
+func TestBoundarySplitter_Streams(t *testing.T) {
+	reader := &countingReader{r: bytes.NewReader(bytes.Repeat([]byte("word "), 200_000))}
+	splitter := BoundarySplitter{Size: 4096, Boundary: WordBoundary}
+
+	err := splitter.Split(reader, func(offset int, data []byte) error {
+		if ahead := reader.read - offset; ahead > 4096+1024+boundaryLookahead {
+			t.Fatalf("read %d bytes past the chunk at %d", ahead, offset)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
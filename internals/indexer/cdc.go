@@ -0,0 +1,95 @@
+package indexer
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"unicode/utf8"
+)
+
+// CDCSplitter cuts text into content-defined chunks with FastCDC (Xia et al., "FastCDC:
+// a Fast and Efficient Content-Defined Chunking Approach for Data Deduplication").
+//
+// A rolling Gear hash runs over the bytes and a chunk ends wherever the hash matches
+// a mask, so where a chunk ends depends only on the bytes just before it. An edit only
+// changes the chunks around it: the cut points after it are found again at the same
+// text, and those chunks keep their SimHash. Fixed-size chunks all move by the length
+// of the edit instead.
+//
+// Chunks are at least Min and at most Max bytes long and average about Avg bytes.
+// Before Avg a harder mask is used and after it an easier one (normalized chunking),
+// which keeps sizes close to Avg. A cut is never placed inside a UTF-8 character.
+type CDCSplitter struct {
+	Min int
+	Avg int
+	Max int
+}
+
+// gear is the table of random values the rolling hash adds for each byte.
+// It is generated from a fixed seed, so cut points are the same in every build.
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0x74657874626c747a) // "textbltz"
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Validate checks that 0 < Min < Avg < Max
+func (s CDCSplitter) Validate() error {
+	if s.Min <= 0 || s.Min >= s.Avg || s.Avg >= s.Max {
+		return fmt.Errorf("invalid content-defined chunk sizes: need 0 < min (%d) < average (%d) < max (%d)", s.Min, s.Avg, s.Max)
+	}
+	return nil
+}
+
+// Split implements Splitter
+func (s CDCSplitter) Split(r io.Reader, emit func(offset int, data []byte) error) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	// the mask has as many bits as the average size needs, plus one before the
+	// average and minus one after it; the high bits of a Gear hash mix the most input
+	avgBits := bits.Len(uint(s.Avg)) - 1
+	maskSmall := ^uint64(0) << (64 - (avgBits + 1))
+	maskLarge := ^uint64(0) << (64 - (avgBits - 1))
+
+	// read a little past Max, so a cut there can see where the next character starts
+	return splitWindows(r, s.Max+utf8.UTFMax, func(buf []byte, eof bool) int {
+		return s.cut(buf, eof, maskSmall, maskLarge)
+	}, emit)
+}
+
+// cut returns where the chunk at the start of buf ends
+func (s CDCSplitter) cut(buf []byte, eof bool, maskSmall, maskLarge uint64) int {
+	n := min(len(buf), s.Max)
+	if n <= s.Min {
+		return n
+	}
+
+	var hash uint64
+	i := s.Min
+	for ; i < min(n, s.Avg); i++ {
+		hash = hash<<1 + gear[buf[i]]
+		if hash&maskSmall == 0 {
+			return runeCut(buf, i+1)
+		}
+	}
+	for ; i < n; i++ {
+		hash = hash<<1 + gear[buf[i]]
+		if hash&maskLarge == 0 {
+			return runeCut(buf, i+1)
+		}
+	}
+	if eof && n == len(buf) {
+		return n // the rest of the input
+	}
+	return runeCut(buf, n)
+}
@@ -0,0 +1,70 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestCDCSplitter_Sizes checks that chunks stay within Min and Max and average about Avg
+func TestCDCSplitter_Sizes(t *testing.T) {
+	text := jungleBook(t)
+	splitter := CDCSplitter{Min: 256, Avg: 1024, Max: 4096}
+
+	chunks := splitAll(t, splitter, text)
+	for _, c := range chunks[:len(chunks)-1] {
+		if len(c.data) < splitter.Min || len(c.data) > splitter.Max {
+			t.Errorf("chunk at %d is %d bytes, outside [%d, %d]", c.offset, len(c.data), splitter.Min, splitter.Max)
+		}
+	}
+	if avg := len(text) / len(chunks); avg < splitter.Avg/2 || avg > splitter.Avg*2 {
+		t.Errorf("average chunk is %d bytes, expected about %d", avg, splitter.Avg)
+	}
+}
+
+// TestCDCSplitter_Stable checks that an edit near the start leaves the chunks after it unchanged
+func TestCDCSplitter_Stable(t *testing.T) {
+	text := jungleBook(t)
+	edited := text[:500] + "X" + text[500:]
+
+	unchanged := func(s Splitter) float64 {
+		before := map[string]bool{}
+		for _, c := range splitAll(t, s, text) {
+			before[c.data] = true
+		}
+		after := splitAll(t, s, edited)
+		kept := 0
+		for _, c := range after {
+			if before[c.data] {
+				kept++
+			}
+		}
+		return float64(kept) / float64(len(after))
+	}
+
+	if kept := unchanged(CDCSplitter{Min: 256, Avg: 1024, Max: 4096}); kept < 0.9 {
+		t.Errorf("only %.0f%% of content-defined chunks survived a one byte edit", kept*100)
+	}
+	if kept := unchanged(FixedSplitter{Size: 1024}); kept > 0.1 {
+		t.Errorf("%.0f%% of fixed-size chunks survived a one byte edit, expected almost none", kept*100)
+	}
+}
+
+// TestCDCSplitter_Runes checks that a cut never falls inside a UTF-8 character
+func TestCDCSplitter_Runes(t *testing.T) {
+	text := strings.Repeat("日本語のテキスト、", 2000)
+	for _, c := range splitAll(t, CDCSplitter{Min: 64, Avg: 256, Max: 1024}, text) {
+		if !utf8.ValidString(c.data) {
+			t.Fatalf("chunk at %d splits a character", c.offset)
+		}
+	}
+}
+
+func TestCDCSplitter_InvalidSizes(t *testing.T) {
+	for _, s := range []CDCSplitter{{0, 1024, 4096}, {1024, 1024, 4096}, {256, 4096, 1024}} {
+		err := s.Split(strings.NewReader("text"), func(int, []byte) error { return nil })
+		if err == nil {
+			t.Errorf("expected an error for sizes %+v", s)
+		}
+	}
+}
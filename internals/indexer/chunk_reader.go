@@ -0,0 +1,187 @@
+package indexer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Excerpt is a chunk read back from its source file, together with
+// the context bytes that surround it.
+type Excerpt struct {
+	Before []byte
+	Text   []byte
+	After  []byte
+}
+
+// ChunkReader reads indexed chunks back from their source files.
+//
+// Plain text is read in place with ReadAt, and so is text in another encoding, whose
+// chunks were recorded by their place in the file; the bytes read are decoded to UTF-8.
+// PDF, DOCX, XML and HTML sources were indexed from their extracted text, so they are
+// re-extracted (once per file, then cached) and the offsets are applied to that text
+// instead. Compressed files and files inside archives are decompressed into memory and
+// read from there. Which is which is told from the content of the file, as when it was
+// indexed, unless SetReadOptions gives the type it was indexed as.
+type ChunkReader struct {
+	mu      sync.Mutex
+	sources map[string]*source
+
+	// opts are the type and encoding sources were indexed as, see SetReadOptions
+	opts ReadOptions
+}
+
+// source is how the chunks of a file are read back
+type source struct {
+	inPlace bool          // the chunks are read from the file on disk
+	data    []byte        // if not, the extracted text, or the decompressed source
+	enc     *textEncoding // what the source is decoded from, nil for UTF-8 and extracted text
+}
+
+// NewChunkReader creates a chunk reader with an empty document cache
+func NewChunkReader() *ChunkReader {
+	return &ChunkReader{sources: make(map[string]*source)}
+}
+
+// SetReadOptions sets the type and the encoding sources were read as when they were
+// indexed, if they were given rather than detected; the zero value detects them again
+// (see ParseType and ParseEncoding)
+func (cr *ChunkReader) SetReadOptions(opts ReadOptions) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if opts != cr.opts {
+		cr.opts = opts
+		cr.sources = make(map[string]*source)
+	}
+}
+
+// Read returns size bytes at position in filename, plus up to context bytes
+// on each side. The context is clipped at the start and end of the source.
+// The text of a source in another encoding is returned as UTF-8.
+func (cr *ChunkReader) Read(filename string, position, size, context int) (Excerpt, error) {
+	if position < 0 || size < 0 {
+		return Excerpt{}, fmt.Errorf("invalid chunk position %d or size %d", position, size)
+	}
+	if context < 0 {
+		context = 0
+	}
+	src, err := cr.source(filename)
+	if err != nil {
+		return Excerpt{}, err
+	}
+
+	start := max(position-context, 0)
+	end := position + size + context
+	if src.enc != nil {
+		// the context starts after the byte order mark, on a character boundary
+		start = max(start, src.enc.bom)
+		start += (start - src.enc.bom) % src.enc.unit
+		start = min(start, position)
+	}
+
+	var region []byte
+	if !src.inPlace {
+		if position > len(src.data) {
+			return Excerpt{}, fmt.Errorf("position %d is past the end of %s", position, filename)
+		}
+		region = src.data[start:min(end, len(src.data))]
+	} else {
+		data, err := readRange(filename, start, end-start)
+		if err != nil {
+			return Excerpt{}, err
+		}
+		region = data
+	}
+
+	// split the region back into context / chunk / context
+	chunkStart := min(position-start, len(region))
+	chunkEnd := min(chunkStart+size, len(region))
+	excerpt := Excerpt{
+		Before: region[:chunkStart],
+		Text:   region[chunkStart:chunkEnd],
+		After:  region[chunkEnd:],
+	}
+	if src.enc != nil {
+		excerpt.Before = src.enc.decodeString(excerpt.Before)
+		excerpt.Text = src.enc.decodeString(excerpt.Text)
+		excerpt.After = src.enc.decodeString(excerpt.After)
+	}
+	return excerpt, nil
+}
+
+// source returns how filename is read back, working it out on first use
+func (cr *ChunkReader) source(filename string) (*source, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if src, ok := cr.sources[filename]; ok {
+		return src, nil
+	}
+	src, err := openSource(filename, cr.opts)
+	if err != nil {
+		return nil, err
+	}
+	cr.sources[filename] = src
+	return src, nil
+}
+
+// openSource works out how the chunks of filename are read back
+func openSource(filename string, opts ReadOptions) (*source, error) {
+	var d *document
+	if archive, member, ok := SplitMember(filename); ok {
+		var err error
+		if d, err = memberDocument(archive, member, opts); err != nil {
+			return nil, err
+		}
+	} else {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open source file: %w", err)
+		}
+		defer file.Close()
+		if d, err = openDocument(file, filename, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	src := &source{}
+	switch d.typ {
+	case TypeText, TypeBinary:
+		// binary files were indexed if they were given as text
+		enc, err := d.textEncoding()
+		if err != nil {
+			return nil, err
+		}
+		src.enc = enc
+		if d.file != nil {
+			src.inPlace = true
+			return src, nil
+		}
+		src.data, err = io.ReadAll(d.r)
+		return src, err
+	default:
+		text, err := d.text()
+		if err != nil {
+			return nil, err
+		}
+		src.data, err = io.ReadAll(text)
+		return src, err
+	}
+}
+
+// readRange reads up to length bytes starting at offset from a plain file
+func readRange(filename string, offset, length int) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+
+	buf := make([]byte, length)
+	n, err := file.ReadAt(buf, int64(offset))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read chunk from %s: %w", filename, err)
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,39 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestChunkReaderRead tests reading a chunk back with context clipped at the file edges
+func TestChunkReaderRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sample.txt")
+	if err := os.WriteFile(path, []byte("0123456789abcdefghij"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                string
+		position, size, ctx int
+		before, text, after string
+	}{
+		{name: "no context", position: 10, size: 5, ctx: 0, before: "", text: "abcde", after: ""},
+		{name: "with context", position: 10, size: 5, ctx: 3, before: "789", text: "abcde", after: "fgh"},
+		{name: "clipped at start", position: 1, size: 2, ctx: 4, before: "0", text: "12", after: "3456"},
+		{name: "clipped at end", position: 18, size: 5, ctx: 2, before: "gh", text: "ij", after: ""},
+	}
+
+	reader := NewChunkReader()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			excerpt, err := reader.Read(path, tt.position, tt.size, tt.ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(excerpt.Before) != tt.before || string(excerpt.Text) != tt.text || string(excerpt.After) != tt.after {
+				t.Errorf("Read() = %q|%q|%q, want %q|%q|%q", excerpt.Before, excerpt.Text, excerpt.After, tt.before, tt.text, tt.after)
+			}
+		})
+	}
+}
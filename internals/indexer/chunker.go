@@ -1,105 +1,94 @@
 package indexer
 
 import (
-	"errors"
-	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
-
-	"code.sajari.com/docconv"
 )
 
 // Chunk divides a file into chunks of specified size
 // Supports .txt, .pdf, and .docx files
+//
+// Every chunk is held in memory; IndexManager streams chunks through a Splitter instead.
 func Chunk(filename string, chunkSize int) ([][]byte, error) {
-	// Get file extension
-	ext := strings.ToLower(filepath.Ext(filename))
-	// Process based on file type
-	switch ext {
-	case ".txt":
-		return chunkFileWithGoroutines(filename, chunkSize)
-	case ".pdf", ".docx", "xml":
-		data, err := extractTextFromDoc(filename)
-		if err != nil {
-			return nil, err
-		}
-		return chunkDataWithGoroutines(data, chunkSize)
-
-	default:
-		return nil, errors.New("unsupported file type: " + ext)
+	file, err := OpenText(filename)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
+	return collectChunks(file, FixedSplitter{Size: chunkSize})
 }
 
-// chunkFileWithGoroutines chunks a file using goroutines
-func chunkFileWithGoroutines(filename string, chunkSize int) ([][]byte, error) {
+// ChunkStream reads everything from r and divides it into chunks of the specified size.
+// The input is treated as plain text.
+func ChunkStream(r io.Reader, chunkSize int) ([][]byte, error) {
+	return collectChunks(r, FixedSplitter{Size: chunkSize})
+}
+
+// OpenText opens a file for chunking and returns a reader over its text.
+//
+// The type of the file is told from its content, not its extension (see Detect).
+// Plain text is streamed straight from disk, decoded to UTF-8 if it is in another
+// encoding (see DetectEncoding); text extracted from PDF, DOCX, XML and
+// HTML documents is held in memory, since the converters only produce the text as a
+// whole. Compressed files (gzip, bzip2, xz) are decompressed as they are read, and a
+// file inside an archive ("bundle.zip!/docs/a.txt", see SplitMember) is read from the
+// archive. A file that isn't text returns a *BinaryError.
+func OpenText(filename string) (io.ReadCloser, error) {
+	return OpenTextAs(filename, ReadOptions{})
+}
+
+// OpenTextAs is OpenText for a file whose type or encoding opts gives, rather than
+// the detected ones
+func OpenTextAs(filename string, opts ReadOptions) (io.ReadCloser, error) {
+	if archive, member, ok := SplitMember(filename); ok {
+		return openMember(archive, member, opts)
+	}
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-
-	fileInfo, err := file.Stat()
+	d, err := openDocument(file, filename, opts)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
-
-	fileSize := fileInfo.Size()
-	numChunks := int((fileSize + int64(chunkSize) - 1) / int64(chunkSize))
-
-	chunks := make([][]byte, numChunks)
-	var wg sync.WaitGroup
-	wg.Add(numChunks)
-
-	for i := 0; i < numChunks; i++ {
-		go func(i int) {
-			defer wg.Done()
-			offset := int64(i * chunkSize)
-			buf := make([]byte, chunkSize)
-			n, _ := file.ReadAt(buf, offset)
-			chunks[i] = buf[:n]
-		}(i)
+	text, err := d.text()
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
-
-	wg.Wait()
-	return chunks, nil
+	return readCloser{text, file.Close}, nil
 }
 
-// chunkDataWithGoroutines chunks a byte slice using goroutines
-func chunkDataWithGoroutines(data []byte, chunkSize int) ([][]byte, error) {
-	dataLen := len(data)
-	numChunks := (dataLen + chunkSize - 1) / chunkSize
-
-	chunks := make([][]byte, numChunks)
-	var wg sync.WaitGroup
-	wg.Add(numChunks)
-
-	for i := range numChunks {
-		go func(i int) {
-			defer wg.Done()
-			start := i * chunkSize
-			end := start + chunkSize
-			if end > dataLen {
-				end = dataLen
-			}
-			chunks[i] = make([]byte, end-start)
-			copy(chunks[i], data[start:end])
-		}(i)
+// Supported reports whether a file found while walking a directory is worth indexing:
+// text, data and documents by their extension (.txt, .csv, .tsv, .jsonl, .pdf, .docx,
+// .xml, .html), compressed or not, archives of such files (see IsArchive), and files with no extension at all,
+// whose content tells what they are
+func Supported(filename string) bool {
+	if IsArchive(filename) {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(uncompressedName(filename))) {
+	case "", ".txt", ".pdf", ".docx", ".xml", ".html", ".htm", ".csv", ".tsv", ".jsonl", ".ndjson":
+		return true
+	default:
+		return false
 	}
-
-	wg.Wait()
-	return chunks, nil
 }
 
-// extractTextFromDoc extracts  text from pdf , docx or xml using sajari's docconv library
-//
-// takes a file path as input and returns the extracted text as slice of  bytes
-func extractTextFromDoc(filename string) ([]byte, error) {
-	result, err := docconv.ConvertPath(filename)
+// ReadText returns the full text of a file the same way the indexer sees it, see OpenText.
+// A filename of "-" reads from stdin.
+func ReadText(filename string) ([]byte, error) {
+	if filename == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	file, err := OpenText(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert document to text: %v", err)
+		return nil, err
 	}
-	return []byte(result.Body), nil
+	defer file.Close()
+	return io.ReadAll(file)
 }
 
@@ -0,0 +1,353 @@
+package indexer
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Type is the kind of content a file holds, which picks how its text is extracted
+type Type string
+
+const (
+	TypeText   Type = "text"   // plain text, UTF-8 or UTF-16 with a byte order mark
+	TypePDF    Type = "pdf"    // text extracted with pdftotext
+	TypeDOCX   Type = "docx"   // the text of a Word (OOXML) document
+	TypeXML    Type = "xml"    // the character data of an XML document
+	TypeHTML   Type = "html"   // the text of an HTML page, without scripts and styles
+	TypeZip    Type = "zip"    // a zip archive, whose files are indexed one by one
+	TypeTar    Type = "tar"    // a tar archive, whose files are indexed one by one
+	TypeBinary Type = "binary" // anything else, which is not indexed
+)
+
+// sniffLen is how much of the start of a file Detect looks at
+const sniffLen = 8000
+
+// ParseType parses a type given by the user. The empty string means the type
+// is detected; only document types can be given, not archives.
+func ParseType(s string) (Type, error) {
+	switch t := Type(strings.ToLower(s)); t {
+	case "", TypeText, TypePDF, TypeDOCX, TypeXML, TypeHTML:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown type %q (use text, pdf, docx, xml or html)", s)
+	}
+}
+
+// ReadOptions overrides what is detected about input
+type ReadOptions struct {
+	Type     Type   // the type of the content; "" detects it, see Detect
+	Encoding string // the encoding of text; "" detects it, see ParseEncoding and DetectEncoding
+}
+
+// BinaryError reports content that isn't text and that no extractor reads
+type BinaryError struct {
+	Name   string
+	Reason string // what gave the content away
+}
+
+func (e *BinaryError) Error() string {
+	return fmt.Sprintf("%s is not text: %s", e.Name, e.Reason)
+}
+
+// Detect works out the type of content from its first bytes, up to sniffLen of them.
+//
+// Magic bytes are checked first (PDF header, zip and tar containers, UTF-16), then markup
+// (an XML declaration, an HTML doctype or tag), then whether the bytes look like text
+// at all. The extension of name only settles what the content leaves open: markup
+// without a declaration is XML or HTML if the name says so. A zip container is
+// reported as TypeZip; whether it is a Word document depends on the files inside it.
+func Detect(head []byte, name string) Type {
+	t, _ := detect(head, name)
+	return t
+}
+
+// detect is Detect, plus the reason binary content was taken for binary
+func detect(head []byte, name string) (Type, string) {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return TypePDF, ""
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return TypeZip, ""
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return TypeTar, ""
+	case utf16BOM(head), utf16Order(head) != "":
+		return TypeText, ""
+	}
+
+	text := bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	if reason := binaryReason(text); reason != "" {
+		return TypeBinary, reason
+	}
+
+	markup := bytes.ToLower(bytes.TrimLeft(text, " \t\r\n"))
+	switch {
+	case bytes.HasPrefix(markup, []byte("<?xml")):
+		if bytes.Contains(markup, []byte("<html")) {
+			return TypeHTML, ""
+		}
+		return TypeXML, ""
+	case bytes.HasPrefix(markup, []byte("<!doctype html")), bytes.HasPrefix(markup, []byte("<html")):
+		return TypeHTML, ""
+	case bytes.HasPrefix(markup, []byte("<")):
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".xml":
+			return TypeXML, ""
+		case ".html", ".htm", ".xhtml":
+			return TypeHTML, ""
+		}
+	}
+	return TypeText, ""
+}
+
+// binaryReason returns why head doesn't look like text, or "" if it does: text has no
+// NUL bytes, and few control characters other than whitespace and escapes
+func binaryReason(head []byte) string {
+	if i := bytes.IndexByte(head, 0); i >= 0 {
+		return fmt.Sprintf("NUL byte at offset %d", i)
+	}
+	control := 0
+	for _, b := range head {
+		if b < 0x20 && !bytes.ContainsRune([]byte("\t\n\v\f\r\b\x1b"), rune(b)) || b == 0x7f {
+			control++
+		}
+	}
+	if len(head) > 0 && control*10 > len(head) {
+		return fmt.Sprintf("%d%% of the first %d bytes are control characters", control*100/len(head), len(head))
+	}
+	return ""
+}
+
+func utf16BOM(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("\xfe\xff")) || bytes.HasPrefix(head, []byte("\xff\xfe"))
+}
+
+// compressedBy returns the decompressor for content compressed with gzip, bzip2 or xz,
+// judging by its magic bytes, or nil
+func compressedBy(head []byte) func(io.Reader) (io.Reader, error) {
+	var ext string
+	switch {
+	case len(head) >= 3 && string(head[:3]) == "\x1f\x8b\x08":
+		ext = ".gz"
+	case len(head) >= 10 && string(head[:3]) == "BZh" && head[3] >= '1' && head[3] <= '9' &&
+		(string(head[4:10]) == "\x31\x41\x59\x26\x53\x59" || string(head[4:10]) == "\x17\x72\x45\x38\x50\x90"):
+		ext = ".bz2"
+	case bytes.HasPrefix(head, []byte("\xfd7zXZ\x00")):
+		ext = ".xz"
+	default:
+		return nil
+	}
+	open, _, _ := compression(ext)
+	return open
+}
+
+// document is input read just far enough to tell its type, see openDocument
+type document struct {
+	name     string        // the name of the input
+	typ      Type          // the type of its content, once decompressed
+	reason   string        // why the content was taken for binary
+	encoding string        // the encoding of text, "" to detect it
+	r        *bufio.Reader // the decompressed content, from its start
+	file     *os.File      // the input, if r reads it as it is
+}
+
+// openDocument decompresses the content read from r, if it is compressed, and works
+// out its type, unless opts gives it. name is the name of the input; its extension
+// only helps detection (see Detect). Content taken for binary is read as text if opts
+// gives its encoding.
+func openDocument(r io.Reader, name string, opts ReadOptions) (*document, error) {
+	typ := opts.Type
+	d := &document{name: name, encoding: opts.Encoding}
+	d.file, _ = r.(*os.File)
+	d.r = bufio.NewReaderSize(r, sniffLen)
+	for {
+		head, err := d.r.Peek(sniffLen)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		open := compressedBy(head)
+		if open == nil {
+			if typ != "" {
+				d.typ = typ
+			} else {
+				d.typ, d.reason = detect(head, uncompressedName(name))
+			}
+			if d.typ == TypeBinary && d.encoding != "" {
+				d.typ = TypeText
+			}
+			if d.typ == TypeZip {
+				docx, err := isDocx(d)
+				if err != nil {
+					return nil, err
+				}
+				if docx {
+					d.typ = TypeDOCX
+				}
+			}
+			return d, nil
+		}
+		decompressed, err := open(d.r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", name, err)
+		}
+		d.r = bufio.NewReaderSize(decompressed, sniffLen)
+		d.file = nil
+	}
+}
+
+// isDocx reports whether a zip container is a Word document: it has a document part
+// and the content types that say where it is
+func isDocx(d *document) (bool, error) {
+	zr, err := d.zip()
+	if errors.Is(err, zip.ErrFormat) {
+		return false, nil // not a zip container after all; walking it reports the error
+	}
+	if err != nil {
+		return false, err
+	}
+	var document, contentTypes bool
+	for _, f := range zr.File {
+		switch f.Name {
+		case "word/document.xml":
+			document = true
+		case "[Content_Types].xml":
+			contentTypes = true
+		}
+	}
+	return document && contentTypes, nil
+}
+
+// zip opens the document as a zip container. The list of files is at the end of the
+// container, so unless the document is read straight from a file it is read into memory.
+// d.r starts over from the beginning afterwards.
+func (d *document) zip() (*zip.Reader, error) {
+	if d.file != nil {
+		if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", d.name, err)
+		}
+		d.r.Reset(d.file)
+		return zipReader(d.file)
+	}
+	data, err := io.ReadAll(d.r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", d.name, err)
+	}
+	d.r.Reset(bytes.NewReader(data))
+	return zipReader(bytes.NewReader(data))
+}
+
+// text returns a reader over the text of the document. Text is streamed: UTF-8 as it
+// is, anything else through a Transcoder (see DetectEncoding). The text of PDF, DOCX,
+// XML and HTML documents is extracted and held in memory, as a PagedText.
+func (d *document) text() (io.Reader, error) {
+	switch d.typ {
+	case TypeText:
+		enc, err := d.textEncoding()
+		if err != nil || enc == nil {
+			return d.r, err
+		}
+		return newTranscoder(d.r, enc)
+	case TypePDF, TypeDOCX, TypeXML, TypeHTML:
+		return d.extractText()
+	case TypeZip, TypeTar:
+		return nil, fmt.Errorf("%s is a %s archive; its files are indexed one by one", d.name, d.typ)
+	default:
+		return nil, &BinaryError{Name: d.name, Reason: d.reason}
+	}
+}
+
+// textEncoding returns the encoding of the text, or nil for UTF-8 without a byte order mark
+func (d *document) textEncoding() (*textEncoding, error) {
+	head, err := d.r.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read %s: %w", d.name, err)
+	}
+	return resolveEncoding(d.encoding, head), nil
+}
+
+// htmlBreaks are the HTML elements that end a line of text
+var htmlBreaks = map[string]bool{
+	"br": true, "p": true, "div": true, "li": true, "tr": true, "title": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// markupText returns the character data of an XML or HTML document, a line break
+// after every element of XML and around the block elements of HTML (see htmlBreaks).
+// HTML is parsed leniently, and the contents of scripts and styles are left out.
+func markupText(r io.Reader, html bool) (string, error) {
+	decoder := xml.NewDecoder(r)
+	if html {
+		decoder.Strict = false
+		decoder.AutoClose = xml.HTMLAutoClose
+		decoder.Entity = xml.HTMLEntity
+	}
+	var text strings.Builder
+	skip := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return text.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(token.Name.Local)
+			if html && (name == "script" || name == "style") {
+				skip++
+			}
+			if html && htmlBreaks[name] {
+				text.WriteByte('\n') // a new block also ends an unclosed one, as in <li>a<li>b
+			}
+		case xml.EndElement:
+			name := strings.ToLower(token.Name.Local)
+			if html && (name == "script" || name == "style") && skip > 0 {
+				skip--
+			}
+			if !html || htmlBreaks[name] {
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if skip == 0 {
+				text.Write(token)
+			}
+		}
+	}
+}
+
+// extractText extracts the text of a PDF, DOCX, XML or HTML document. The text of PDF
+// and DOCX documents knows its pages and sections.
+func (d *document) extractText() (*PagedText, error) {
+	var text *PagedText
+	var err error
+	switch d.typ {
+	case TypePDF:
+		text, err = pdfText(d.r)
+	case TypeDOCX:
+		var zr *zip.Reader
+		if zr, err = d.zip(); err == nil {
+			text, err = docxText(zr)
+		}
+	case TypeXML, TypeHTML:
+		var markup string
+		if markup, err = markupText(d.r, d.typ == TypeHTML); err == nil {
+			var b pageBuilder
+			b.text.WriteString(markup)
+			text = b.paged()
+		}
+	default:
+		return nil, fmt.Errorf("no text extractor for %s", d.typ)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert document to text: %v", err)
+	}
+	return text, nil
+}
@@ -0,0 +1,140 @@
+package indexer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	var tarData bytes.Buffer
+	tw := tar.NewWriter(&tarData)
+	if err := tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0o644}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+
+	tests := []struct {
+		name, head string
+		want       Type
+	}{
+		{"report", "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n", TypePDF},
+		{"report.txt", "%PDF-1.4\n", TypePDF},
+		{"bundle", "PK\x03\x04\x14\x00\x00\x00", TypeZip},
+		{"bundle", tarData.String(), TypeTar},
+		{"notes", "\xff\xfeh\x00i\x00", TypeText},
+		{"notes", "\xfe\xff\x00h\x00i", TypeText},
+		{"notes", "\xef\xbb\xbfplain text", TypeText},
+		{"notes.txt", "plain text\nwith lines\n", TypeText},
+		{"photo.txt", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", TypeBinary},
+		{"data", "\x01\x02\x03\x04abc", TypeBinary},
+		{"feed", "<?xml version=\"1.0\"?><rss></rss>", TypeXML},
+		{"page", "<?xml version=\"1.0\"?>\n<html xmlns=\"http://www.w3.org/1999/xhtml\">", TypeHTML},
+		{"page", "\n  <!DOCTYPE html><html>", TypeHTML},
+		{"page.txt", "<HTML><body>", TypeHTML},
+		{"page.html", "<div>hi</div>", TypeHTML},
+		{"data.xml", "<items><item/></items>", TypeXML},
+		{"notes.txt", "<b>not markup</b> here", TypeText},
+		{"empty", "", TypeText},
+	}
+	for _, tt := range tests {
+		if got := Detect([]byte(tt.head), tt.name); got != tt.want {
+			t.Errorf("Detect(%q, %q) = %s, want %s", tt.head, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	for _, s := range []string{"", "text", "PDF", "docx", "xml", "html"} {
+		if _, err := ParseType(s); err != nil {
+			t.Errorf("ParseType(%q): unexpected error %v", s, err)
+		}
+	}
+	for _, s := range []string{"zip", "binary", "markdown"} {
+		if _, err := ParseType(s); err == nil {
+			t.Errorf("ParseType(%q): expected an error, but found none", s)
+		}
+	}
+}
+
+// Test that files are read by what they hold, not by what they are called
+func TestOpenText_Detected(t *testing.T) {
+	dir := t.TempDir()
+
+	var docx bytes.Buffer
+	zw := zip.NewWriter(&docx)
+	w, err := zw.Create("[Content_Types].xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`+
+		`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`)
+	if w, err = zw.Create("word/document.xml"); err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, `<?xml version="1.0"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`+
+		`<w:body><w:p><w:r><w:t>from a word document</w:t></w:r></w:p></w:body></w:document>`)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]struct{ data, want string }{
+		"utf16":       {"\xff\xfeh\x00\xe9\x00l\x00l\x00o\x00", "héllo"},
+		"report.bin":  {docx.String(), "from a word document"},
+		"data.xml":    {"<items><item>first</item><item>second</item></items>", "first second"},
+		"page":        {"<!DOCTYPE html><html><head><style>p {}</style><script>var x;</script></head><body><p>Hello</p></body></html>", "Hello"},
+		"readme.html": {"<p>one</p><p>two</p>", "one\ntwo"},
+	}
+	for name, f := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(f.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		text, err := ReadText(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := strings.Join(strings.Fields(string(text)), " "); got != strings.Join(strings.Fields(f.want), " ") {
+			t.Errorf("%s: expected %q, got %q", name, f.want, text)
+		}
+	}
+
+	// UTF-16 text is read back from where it is in the file, and decoded
+	excerpt, err := NewChunkReader().Read(filepath.Join(dir, "utf16"), 4, 2, 2)
+	if err != nil || string(excerpt.Before) != "h" || string(excerpt.Text) != "é" || string(excerpt.After) != "l" {
+		t.Errorf("unexpected excerpt %q, %v", excerpt, err)
+	}
+}
+
+// Test that binary files are refused with the reason, unless read as text anyway
+func TestOpenText_Binary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("text\x00with a NUL byte"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var binary *BinaryError
+	_, err := OpenText(path)
+	if !errors.As(err, &binary) || binary.Reason != "NUL byte at offset 4" {
+		t.Fatalf("Expected a BinaryError for the NUL byte, got %v", err)
+	}
+
+	file, err := OpenTextAs(path, ReadOptions{Type: TypeText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if text, err := io.ReadAll(file); err != nil || string(text) != "text\x00with a NUL byte" {
+		t.Errorf("Expected the file as it is, got %q, %v", text, err)
+	}
+	if excerpt, err := NewChunkReader().Read(path, 5, 4, 0); err != nil || string(excerpt.Text) != "with" {
+		t.Errorf("Expected the chunk read in place, got %q, %v", excerpt.Text, err)
+	}
+}
@@ -0,0 +1,324 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// Encodings text is read in, besides the single-byte encodings named by their IANA
+// names (windows-1252, iso-8859-1, koi8-r, ...)
+const (
+	UTF8    = "utf-8"
+	UTF16   = "utf-16" // UTF-16 of either byte order: the byte order mark says which, little-endian without one
+	UTF16LE = "utf-16le"
+	UTF16BE = "utf-16be"
+)
+
+// legacyEncoding is what text that isn't valid UTF-8 or UTF-16 is taken to be encoded in:
+// a superset of Latin-1 that most legacy Western text is written in
+const legacyEncoding = "windows-1252"
+
+// ParseEncoding parses the name of an encoding given by the user and returns its
+// canonical name. The empty string means the encoding is detected (see DetectEncoding).
+// Besides UTF-8 and UTF-16, any single-byte encoding is known, by any of its IANA
+// names: "latin1" is "iso-8859-1", "cp1252" is "windows-1252".
+func ParseEncoding(name string) (string, error) {
+	switch n := strings.ToLower(strings.TrimSpace(name)); n {
+	case "":
+		return "", nil
+	case "utf-8", "utf8":
+		return UTF8, nil
+	case "utf-16", "utf16":
+		return UTF16, nil
+	case "utf-16le", "utf16le":
+		return UTF16LE, nil
+	case "utf-16be", "utf16be":
+		return UTF16BE, nil
+	}
+	if cm := charmapNamed(name); cm != nil {
+		if canonical, err := ianaindex.MIME.Name(cm); err == nil && canonical != "" {
+			return strings.ToLower(canonical), nil
+		}
+		if canonical, err := ianaindex.IANA.Name(cm); err == nil && canonical != "" {
+			return strings.ToLower(canonical), nil
+		}
+	}
+	return "", fmt.Errorf("unknown encoding %q (use utf-8, utf-16le, utf-16be or a single-byte encoding such as latin1 or windows-1252)", name)
+}
+
+// charmapNamed returns the single-byte encoding with the given name, or nil
+func charmapNamed(name string) *charmap.Charmap {
+	e, err := ianaindex.IANA.Encoding(name)
+	if err != nil || e == nil {
+		e, err = htmlindex.Get(name)
+	}
+	if err != nil {
+		return nil
+	}
+	cm, _ := e.(*charmap.Charmap)
+	return cm
+}
+
+// DetectEncoding works out the encoding of text from its first bytes: a byte order mark,
+// then the NUL bytes that ASCII text in UTF-16 is full of, then whether the bytes are
+// valid UTF-8. Anything else is taken to be windows-1252.
+func DetectEncoding(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xef\xbb\xbf")):
+		return UTF8
+	case bytes.HasPrefix(head, []byte("\xff\xfe")):
+		return UTF16LE
+	case bytes.HasPrefix(head, []byte("\xfe\xff")):
+		return UTF16BE
+	}
+	if order := utf16Order(head); order != "" {
+		return order
+	}
+	// the head may end in the middle of a character
+	valid := head
+	for i := 0; i < utf8.UTFMax && len(valid) > 0 && !utf8.Valid(valid); i++ {
+		valid = valid[:len(valid)-1]
+	}
+	if utf8.Valid(valid) {
+		return UTF8
+	}
+	return legacyEncoding
+}
+
+// utf16Order returns UTF16LE or UTF16BE for text in UTF-16 without a byte order mark,
+// told from its NUL bytes: most characters of such text are ASCII, whose high byte is
+// NUL, and its low bytes are not. It returns "" for anything else.
+func utf16Order(head []byte) string {
+	units := len(head) / 2
+	if units < 2 {
+		return ""
+	}
+	var even, odd int
+	for i := 0; i+1 < len(head); i += 2 {
+		if head[i] == 0 {
+			even++
+		}
+		if head[i+1] == 0 {
+			odd++
+		}
+	}
+	switch {
+	case odd*2 > units && even*20 < units:
+		return UTF16LE
+	case even*2 > units && odd*20 < units:
+		return UTF16BE
+	default:
+		return ""
+	}
+}
+
+// textEncoding decodes text in some encoding one character at a time
+type textEncoding struct {
+	name string
+	bom  int // length of the byte order mark the text starts with, 0 if none
+	unit int // the length of a code unit: characters start at a multiple of it after the mark
+
+	// decode decodes the character at the start of p and returns it and its length.
+	// It returns 0 if p is too short to hold the whole character.
+	decode func(p []byte) (rune, int)
+}
+
+// resolveEncoding returns the encoding of text that starts with head: the named one
+// (see ParseEncoding), or the detected one if name is empty. It returns nil for UTF-8
+// without a byte order mark, which needs no decoding.
+func resolveEncoding(name string, head []byte) *textEncoding {
+	if name == "" {
+		name = DetectEncoding(head)
+	}
+	if name == UTF16 {
+		name = UTF16LE
+		if bytes.HasPrefix(head, []byte("\xfe\xff")) {
+			name = UTF16BE
+		}
+	}
+
+	enc := &textEncoding{name: name, unit: 1}
+	switch name {
+	case UTF8:
+		if !bytes.HasPrefix(head, []byte("\xef\xbb\xbf")) {
+			return nil
+		}
+		enc.bom = 3
+		enc.decode = func(p []byte) (rune, int) {
+			if !utf8.FullRune(p) {
+				return 0, 0
+			}
+			return utf8.DecodeRune(p)
+		}
+	case UTF16LE, UTF16BE:
+		if bytes.HasPrefix(head, []byte("\xff\xfe")) && name == UTF16LE || bytes.HasPrefix(head, []byte("\xfe\xff")) && name == UTF16BE {
+			enc.bom = 2
+		}
+		enc.unit = 2
+		unit := func(p []byte) rune { return rune(p[0]) | rune(p[1])<<8 }
+		if name == UTF16BE {
+			unit = func(p []byte) rune { return rune(p[0])<<8 | rune(p[1]) }
+		}
+		enc.decode = func(p []byte) (rune, int) {
+			if len(p) < 2 {
+				return 0, 0
+			}
+			r := unit(p)
+			if !utf16.IsSurrogate(r) {
+				return r, 2
+			}
+			if len(p) < 4 {
+				return 0, 0
+			}
+			if r2 := utf16.DecodeRune(r, unit(p[2:])); r2 != utf8.RuneError {
+				return r2, 4
+			}
+			return utf8.RuneError, 2
+		}
+	default:
+		cm := charmapNamed(name)
+		if cm == nil {
+			return nil // ParseEncoding has already checked the name
+		}
+		enc.decode = func(p []byte) (rune, int) {
+			if len(p) < 1 {
+				return 0, 0
+			}
+			return cm.DecodeByte(p[0]), 1
+		}
+	}
+	return enc
+}
+
+// decodeString decodes src, which starts on a character boundary, to UTF-8.
+// An incomplete character at the end is left out.
+func (enc *textEncoding) decodeString(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+	for len(src) > 0 {
+		r, n := enc.decode(src)
+		if n == 0 {
+			break
+		}
+		out = utf8.AppendRune(out, r)
+		src = src[n:]
+	}
+	return out
+}
+
+// Transcoder reads text in another encoding as UTF-8, and keeps track of where every
+// character of the decoded text is in the source, so chunks of the decoded text can be
+// recorded by their place in the source file.
+type Transcoder struct {
+	r       io.Reader
+	enc     *textEncoding
+	src     []byte // source bytes read but not decoded yet
+	out     []byte // decoded text not returned yet
+	err     error  // the error that ended reading the source
+	srcPos  int    // source offset of the next character to decode
+	outPos  int    // decoded offset of the next character to decode
+	offsets []offsetRun
+}
+
+// offsetRun is a run of characters that all take the same number of bytes in the source
+// and in the decoded text, starting at offsets src and out
+type offsetRun struct {
+	out, src           int
+	outWidth, srcWidth int
+}
+
+// newTranscoder returns a Transcoder over the text read from r in encoding enc.
+// The byte order mark is skipped.
+func newTranscoder(r io.Reader, enc *textEncoding) (*Transcoder, error) {
+	if enc.bom > 0 {
+		if _, err := io.CopyN(io.Discard, r, int64(enc.bom)); err != nil {
+			return nil, err
+		}
+	}
+	return &Transcoder{r: r, enc: enc, srcPos: enc.bom}, nil
+}
+
+// Encoding returns the name of the encoding the text is decoded from
+func (t *Transcoder) Encoding() string {
+	return t.enc.name
+}
+
+func (t *Transcoder) Read(p []byte) (int, error) {
+	for len(t.out) == 0 {
+		if t.err != nil && len(t.src) == 0 {
+			return 0, t.err
+		}
+		if t.err == nil {
+			t.src = slices.Grow(t.src, 32*1024)
+			n, err := t.r.Read(t.src[len(t.src):cap(t.src)])
+			t.src = t.src[:len(t.src)+n]
+			t.err = err
+		}
+		t.decode(t.err != nil)
+	}
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
+
+// decode decodes the whole characters in t.src, and the incomplete one at its end too
+// if the source has ended
+func (t *Transcoder) decode(atEOF bool) {
+	src := t.src
+	for len(src) > 0 {
+		r, n := t.enc.decode(src)
+		if n == 0 {
+			if !atEOF {
+				break
+			}
+			r, n = utf8.RuneError, len(src)
+		}
+		width := utf8.RuneLen(r)
+		if width < 0 {
+			r, width = utf8.RuneError, 3
+		}
+		t.out = utf8.AppendRune(t.out, r)
+
+		last := len(t.offsets) - 1
+		if last < 0 || t.offsets[last].outWidth != width || t.offsets[last].srcWidth != n {
+			t.offsets = append(t.offsets, offsetRun{out: t.outPos, src: t.srcPos, outWidth: width, srcWidth: n})
+		}
+		t.outPos += width
+		t.srcPos += n
+		src = src[n:]
+	}
+	t.src = append(t.src[:0], src...)
+}
+
+// SourceOffset returns the offset in the source of the character at offset in the
+// decoded text. An offset inside a character is moved to the end of that character, so
+// the source of the text between two offsets only holds whole characters.
+//
+// Offsets before the one last passed to Forget can't be looked up any more.
+func (t *Transcoder) SourceOffset(offset int) int {
+	i := sort.Search(len(t.offsets), func(i int) bool { return t.offsets[i].out > offset }) - 1
+	if i < 0 {
+		return t.enc.bom
+	}
+	run := t.offsets[i]
+	chars := (offset - run.out + run.outWidth - 1) / run.outWidth
+	return run.src + chars*run.srcWidth
+}
+
+// Forget drops what SourceOffset needs for the text before offset. The indexer calls it
+// as it goes, so the bookkeeping doesn't grow with the length of the text.
+func (t *Transcoder) Forget(offset int) {
+	i := sort.Search(len(t.offsets), func(i int) bool { return t.offsets[i].out > offset }) - 1
+	if i > 0 {
+		t.offsets = append(t.offsets[:0], t.offsets[i:]...)
+	}
+}
@@ -0,0 +1,128 @@
+package indexer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+func TestParseEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":             "",
+		"UTF8":         UTF8,
+		"utf-16":       UTF16,
+		"UTF-16LE":     UTF16LE,
+		"latin1":       "iso-8859-1",
+		"ISO-8859-1":   "iso-8859-1",
+		"cp1252":       "windows-1252",
+		"windows-1252": "windows-1252",
+		"koi8-r":       "koi8-r",
+	}
+	for name, want := range tests {
+		if got, err := ParseEncoding(name); err != nil || got != want {
+			t.Errorf("ParseEncoding(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"shift_jis", "ebcdic-klingon"} {
+		if _, err := ParseEncoding(name); err == nil {
+			t.Errorf("ParseEncoding(%q): expected an error, but found none", name)
+		}
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		head, want string
+	}{
+		{"plain ascii", UTF8},
+		{"caf\xc3\xa9", UTF8},
+		{"caf\xc3", UTF8}, // cut in the middle of a character
+		{"\xef\xbb\xbfwith a mark", UTF8},
+		{"caf\xe9 cr\xe8me", "windows-1252"},
+		{"\xff\xfeh\x00i\x00", UTF16LE},
+		{"\xfe\xff\x00h\x00i", UTF16BE},
+		{"h\x00e\x00l\x00l\x00o\x00", UTF16LE},
+		{"\x00h\x00e\x00l\x00l\x00o", UTF16BE},
+	}
+	for _, tt := range tests {
+		if got := DetectEncoding([]byte(tt.head)); got != tt.want {
+			t.Errorf("DetectEncoding(%q) = %s, want %s", tt.head, got, tt.want)
+		}
+	}
+}
+
+// Test that decoded text maps back to where every character is in the source
+func TestTranscoder(t *testing.T) {
+	tests := []struct {
+		encoding, source, text string
+	}{
+		{"iso-8859-1", "caf\xe9 cr\xe8me br\xfbl\xe9e", "café crème brûlée"},
+		{"windows-1252", "\x93quoted\x94 \x80 5", "“quoted” € 5"},
+		{UTF16LE, "\xff\xfeh\x00\xe9\x00=\xd8\x00\xde!\x00", "hé😀!"},
+		{UTF16BE, "\x00h\x00\xe9\xd8=\xde\x00\x00!", "hé😀!"},
+		{UTF8, "\xef\xbb\xbfcaf\xc3\xa9", "café"},
+	}
+	for _, tt := range tests {
+		enc := resolveEncoding(tt.encoding, []byte(tt.source))
+		tr, err := newTranscoder(iotest.OneByteReader(bytes.NewReader([]byte(tt.source))), enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := io.ReadAll(tr)
+		if err != nil || string(text) != tt.text {
+			t.Errorf("%s: expected %q, got %q, %v", tt.encoding, tt.text, text, err)
+			continue
+		}
+
+		// every character maps back to the source bytes that decode to it
+		for offset, r := range tt.text {
+			start, end := tr.SourceOffset(offset), tr.SourceOffset(offset+utf8.RuneLen(r))
+			if got := string(enc.decodeString([]byte(tt.source[start:end]))); got != string(r) {
+				t.Errorf("%s: character at %d maps to %q, which decodes to %q", tt.encoding, offset, tt.source[start:end], got)
+			}
+			// an offset inside the character is moved to its end
+			if utf8.RuneLen(r) > 1 && tr.SourceOffset(offset+1) != end {
+				t.Errorf("%s: offset %d inside %q maps to %d, want %d", tt.encoding, offset+1, r, tr.SourceOffset(offset+1), end)
+			}
+		}
+		if got := tr.SourceOffset(len(tt.text)); got != len(tt.source) {
+			t.Errorf("%s: end of text maps to %d, want %d", tt.encoding, got, len(tt.source))
+		}
+
+		tr.Forget(len(tt.text) - 1)
+		if got := tr.SourceOffset(len(tt.text)); got != len(tt.source) {
+			t.Errorf("%s: end of text maps to %d after Forget, want %d", tt.encoding, got, len(tt.source))
+		}
+	}
+}
+
+// Test that text in another encoding is read back from its place in the file
+func TestChunkReader_Encoded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "menu.txt")
+	source := "Caf\xe9 du coin: cr\xe8me br\xfbl\xe9e"
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := ReadText(path)
+	if err != nil || string(text) != "Café du coin: crème brûlée" {
+		t.Fatalf("Expected the decoded text, got %q, %v", text, err)
+	}
+
+	// "crème" is bytes 14-19 of the file
+	excerpt, err := NewChunkReader().Read(path, 14, 5, 3)
+	if err != nil || string(excerpt.Before) != "n: " || string(excerpt.Text) != "crème" || string(excerpt.After) != " br" {
+		t.Errorf("unexpected excerpt %q, %v", excerpt, err)
+	}
+
+	// a given encoding is used instead of the detected one
+	cr := NewChunkReader()
+	cr.SetReadOptions(ReadOptions{Encoding: "koi8-r"})
+	if excerpt, err := cr.Read(path, 0, 4, 0); err != nil || string(excerpt.Text) != "CafИ" {
+		t.Errorf("Expected the text decoded as koi8-r, got %q, %v", excerpt.Text, err)
+	}
+}
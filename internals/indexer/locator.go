@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Location is where a chunk is in its text, in the lines and columns editors use, for
+// documents with pages (see PagedText) in the pages and sections their readers use, and
+// for records in the numbers and keys that identify them
+type Location struct {
+	Line       int // line the chunk starts on, from 1
+	EndLine    int // line the last byte of the chunk is on
+	Column     int // character the chunk starts at on Line, from 1
+	RuneOffset int // number of characters before the chunk
+
+	Page    int    // page the chunk starts on, from 1; 0 if the text has no pages
+	EndPage int    // page the last byte of the chunk is on
+	Section string // heading of the section the chunk starts in, "" if none
+
+	Record int    // number of the record the chunk is, from 1; 0 unless split by record (see SplitRecords)
+	Key    string // value of the key field of the record, "" if none
+}
+
+// Locator works out the Location of each chunk of a stream as the chunks are split.
+//
+// Chunks have to be located in order, each one starting inside or right after the
+// previous one, which is how every Splitter emits them. Only the bytes between two
+// chunk starts and the bytes of each chunk are scanned, so this is a single pass over
+// the input (more with overlapping chunks).
+type Locator struct {
+	offset int      // byte offset of the previous chunk
+	start  position // where the previous chunk starts
+	data   []byte   // the previous chunk
+}
+
+// position counts lines and characters up to a byte offset, from 0
+type position struct {
+	line, column, runes int
+}
+
+// Locate returns the location of the chunk data that starts at byte offset
+func (l *Locator) Locate(offset int, data []byte) (Location, error) {
+	skip := offset - l.offset
+	if skip < 0 || skip > len(l.data) {
+		return Location{}, fmt.Errorf("chunk at byte %d doesn't follow the chunk at byte %d", offset, l.offset)
+	}
+
+	start := l.start.advance(l.data[:skip])
+	end := start
+	if len(data) > 0 {
+		end = start.advance(data[:len(data)-1])
+	}
+	l.offset, l.start, l.data = offset, start, data
+
+	return Location{
+		Line:       start.line + 1,
+		EndLine:    end.line + 1,
+		Column:     start.column + 1,
+		RuneOffset: start.runes,
+	}, nil
+}
+
+// advance returns the position after text. A character split across two chunks is
+// counted where it starts.
+func (p position) advance(text []byte) position {
+	for _, b := range text {
+		switch {
+		case b == '\n':
+			p.line++
+			p.column = 0
+			p.runes++
+		case utf8.RuneStart(b):
+			p.column++
+			p.runes++
+		}
+	}
+	return p
+}
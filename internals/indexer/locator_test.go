@@ -0,0 +1,87 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLocator(t *testing.T) {
+	text := "first line\nsecond línea\n\nfourth line\nlast"
+
+	tests := []struct {
+		name   string
+		offset int
+		size   int
+		want   Location
+	}{
+		{"start", 0, 6, Location{Line: 1, EndLine: 1, Column: 1, RuneOffset: 0}},
+		{"across a newline", 6, 10, Location{Line: 1, EndLine: 2, Column: 7, RuneOffset: 6}},
+		{"overlapping the previous chunk", 12, 9, Location{Line: 2, EndLine: 2, Column: 2, RuneOffset: 12}},
+		{"after a multi-byte character", 21, 5, Location{Line: 2, EndLine: 3, Column: 10, RuneOffset: 20}},
+		{"right after the previous chunk", 26, len(text) - 26, Location{Line: 4, EndLine: 5, Column: 1, RuneOffset: 25}},
+	}
+
+	var locator Locator
+	for _, tt := range tests {
+		got, err := locator.Locate(tt.offset, []byte(text[tt.offset:tt.offset+tt.size]))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := locator.Locate(0, []byte("first")); err == nil {
+		t.Error("Expected an error for a chunk before the previous one, but found none")
+	}
+}
+
+// TestLocator_Splitters checks locations against the text before each chunk, for every kind of split
+func TestLocator_Splitters(t *testing.T) {
+	text := jungleBook(t)
+	splitters := map[string]Splitter{
+		"fixed":    FixedSplitter{Size: 1000},
+		"stride":   FixedSplitter{Size: 1000, Stride: 300},
+		"sentence": BoundarySplitter{Size: 1000, Boundary: SentenceBoundary},
+		"cdc":      CDCSplitter{Min: 250, Avg: 1000, Max: 4000},
+	}
+
+	for name, splitter := range splitters {
+		var locator Locator
+		err := splitter.Split(strings.NewReader(text), func(offset int, data []byte) error {
+			got, err := locator.Locate(offset, data)
+			if err != nil {
+				return err
+			}
+			before := text[:offset]
+			lineStart := strings.LastIndexByte(before, '\n') + 1
+			want := Location{
+				Line:       strings.Count(before, "\n") + 1,
+				EndLine:    strings.Count(text[:offset+len(data)-1], "\n") + 1,
+				Column:     countRunes(before[lineStart:]) + 1,
+				RuneOffset: countRunes(before),
+			}
+			if got != want {
+				t.Fatalf("%s: chunk at %d: got %+v, want %+v", name, offset, got, want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+// countRunes counts the characters that start in s, so a fixed-size chunk that ends
+// inside a character still counts it once
+func countRunes(s string) int {
+	n := 0
+	for i := range len(s) {
+		if utf8.RuneStart(s[i]) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,275 @@
+package indexer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"code.sajari.com/docconv"
+)
+
+// PagedText is the text extracted from a document, which knows the page and the section
+// every part of it is on, so chunks can be placed where a reader of the document finds
+// them: "page 37, section 4.2". Offsets are byte offsets into the extracted text.
+type PagedText struct {
+	*bytes.Reader
+	pages    []int     // where each page starts, nil if the document doesn't say
+	headings []heading // the section headings, in order
+}
+
+// IsDocument reports whether the file called name is a PDF or Word document, told from
+// its extension once compression is stripped: a document whose text is extracted with
+// its pages and sections
+func IsDocument(name string) bool {
+	switch strings.ToLower(filepath.Ext(uncompressedName(name))) {
+	case ".pdf", ".docx":
+		return true
+	default:
+		return false
+	}
+}
+
+// heading is a section heading and where it starts in the text
+type heading struct {
+	offset int
+	title  string
+}
+
+// maxHeadingLen is the number of characters a section heading is cut to
+const maxHeadingLen = 80
+
+// Page returns the page the text at offset is on, from 1, or 0 if the document doesn't
+// say where its pages start. An empty page shares its offset with the next one, and the
+// text is on the last page starting there.
+func (t *PagedText) Page(offset int) int {
+	return sort.Search(len(t.pages), func(i int) bool { return t.pages[i] > offset })
+}
+
+// Section returns the heading of the section the text at offset is in, or "" for text
+// before the first heading
+func (t *PagedText) Section(offset int) string {
+	i := sort.Search(len(t.headings), func(i int) bool { return t.headings[i].offset > offset }) - 1
+	if i < 0 {
+		return ""
+	}
+	return t.headings[i].title
+}
+
+// pageBuilder collects the text of a document with where its pages and headings start
+type pageBuilder struct {
+	text     strings.Builder
+	pages    []int
+	headings []heading
+}
+
+// newPage starts a new page at the end of the text so far. A break with only whitespace
+// since the previous one, such as Word's record of a rendered break right after an
+// explicit one, starts no new page.
+func (b *pageBuilder) newPage() {
+	start := 0
+	if n := len(b.pages); n > 0 {
+		start = b.pages[n-1]
+	}
+	if strings.TrimSpace(b.text.String()[start:]) == "" {
+		return
+	}
+	if len(b.pages) == 0 {
+		b.pages = append(b.pages, 0)
+	}
+	b.pages = append(b.pages, b.text.Len())
+}
+
+// heading records a section heading that starts at offset
+func (b *pageBuilder) heading(offset int, title string) {
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return
+	}
+	if utf8.RuneCountInString(title) > maxHeadingLen {
+		title = string([]rune(title)[:maxHeadingLen-1]) + "…"
+	}
+	b.headings = append(b.headings, heading{offset, title})
+}
+
+// paged returns the text with the whitespace around it trimmed, and its pages and
+// headings moved to match. A page starts at its first text, so the line break of a
+// paragraph that a page break ends stays on the page before.
+func (b *pageBuilder) paged() *PagedText {
+	text := b.text.String()
+	trimmed := strings.TrimLeft(text, " \t\r\n\f\v")
+	lead := len(text) - len(trimmed)
+	trimmed = strings.TrimSpace(trimmed)
+
+	t := &PagedText{Reader: bytes.NewReader([]byte(trimmed))}
+	for _, start := range b.pages {
+		start += len(text[start:]) - len(strings.TrimLeft(text[start:], " \t\r\n\f\v"))
+		t.pages = append(t.pages, max(start-lead, 0))
+	}
+	for _, h := range b.headings {
+		t.headings = append(t.headings, heading{max(h.offset-lead, 0), h.title})
+	}
+	return t
+}
+
+// pdfText extracts the text of a PDF document with pdftotext, which ends every page
+// with a form feed. Sections are told by their numbered headings (see pdfHeading),
+// as the text of a PDF doesn't say which lines are headings.
+func pdfText(r io.Reader) (*PagedText, error) {
+	f, err := docconv.NewLocalFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("error creating local file: %v", err)
+	}
+	defer f.Done()
+
+	out, err := exec.Command("pdftotext", "-q", "-enc", "UTF-8", "-eol", "unix", f.Name(), "-").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var b pageBuilder
+	pages := strings.Split(string(out), "\f")
+	if len(pages) > 1 && strings.TrimSpace(pages[len(pages)-1]) == "" {
+		pages = pages[:len(pages)-1] // the form feed after the last page
+	}
+	for i, page := range pages {
+		if i > 0 {
+			b.text.WriteByte('\n') // in place of the form feed, so lines stay lines
+			b.pages = append(b.pages, b.text.Len())
+		} else {
+			b.pages = append(b.pages, 0)
+		}
+		for _, line := range strings.SplitAfter(page, "\n") {
+			if pdfHeading(line) {
+				b.heading(b.text.Len()+len(line)-len(strings.TrimLeft(line, " \t")), line)
+			}
+			b.text.WriteString(line)
+		}
+	}
+	return b.paged(), nil
+}
+
+// numberedHeading matches a line that starts like "4.2 Results" or "3. Method"
+var numberedHeading = regexp.MustCompile(`^\s*\d{1,3}(\.\d{1,3})*\.?\s+\p{Lu}`)
+
+// pdfHeading reports whether a line of PDF text looks like a numbered section heading:
+// short, starting with a section number and a capital letter, and not ending like a
+// sentence or a line of a table of contents
+func pdfHeading(line string) bool {
+	line = strings.TrimSpace(line)
+	if utf8.RuneCountInString(line) > maxHeadingLen || !numberedHeading.MatchString(line) {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(line)
+	return !strings.ContainsRune(".,;:", last) && (last < '0' || last > '9') && !strings.Contains(line, "...")
+}
+
+// docxText extracts the text of a Word document: every paragraph of its body on a line,
+// with the page breaks written in it and the paragraphs styled as headings. Word only
+// records where pages break when it has laid the document out, so the pages of a
+// document that has never been opened in Word are not known.
+func docxText(zr *zip.Reader) (*PagedText, error) {
+	var part *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			part = f
+		}
+	}
+	if part == nil {
+		return nil, fmt.Errorf("no word/document.xml in the document")
+	}
+	rc, err := part.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var b pageBuilder
+	decoder := xml.NewDecoder(rc)
+	var start int       // where the current paragraph starts
+	var isHeading bool  // whether the current paragraph is a heading
+	var inText, ok bool // inside a <w:t>; the document had a <w:body>
+	var inProps bool    // inside the properties of a paragraph, whose tabs are tab stops
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "body":
+				ok = true
+			case "p":
+				start, isHeading = b.text.Len(), false
+			case "pPr":
+				inProps = true
+			case "pStyle":
+				style := strings.ToLower(wordAttr(token, "val"))
+				isHeading = isHeading || strings.HasPrefix(style, "heading") || style == "title"
+			case "outlineLvl":
+				isHeading = isHeading || wordAttr(token, "val") != "9" // level 9 is body text
+			case "pageBreakBefore":
+				if v := wordAttr(token, "val"); v != "0" && v != "false" {
+					b.newPage()
+				}
+			case "lastRenderedPageBreak":
+				b.newPage()
+			case "br":
+				if wordAttr(token, "type") == "page" {
+					b.newPage()
+				} else {
+					b.text.WriteByte('\n')
+				}
+			case "cr":
+				b.text.WriteByte('\n')
+			case "tab":
+				if !inProps {
+					b.text.WriteByte('\t')
+				}
+			case "t":
+				inText = true
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "t":
+				inText = false
+			case "pPr":
+				inProps = false
+			case "p":
+				if isHeading {
+					b.heading(start, b.text.String()[start:])
+				}
+				b.text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.text.Write(token)
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("word/document.xml has no body")
+	}
+	return b.paged(), nil
+}
+
+// wordAttr returns the value of the attribute with the given local name, "" if there is none
+func wordAttr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package indexer
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// wordDocument zips a Word document whose body is the given WordprocessingML
+func wordDocument(t *testing.T, body string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, `<?xml version="1.0"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`+
+		`<w:body>`+body+`</w:body></w:document>`)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+// Test that the text of a Word document knows its pages and the headings of its sections
+func TestDocxText(t *testing.T) {
+	body := `<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Annual Report</w:t></w:r></w:p>` +
+		`<w:p><w:pPr><w:tabs><w:tab w:val="left" w:pos="720"/></w:tabs></w:pPr><w:r><w:t>Prepared by</w:t><w:tab/><w:t>the board</w:t></w:r>` +
+		`<w:r><w:br w:type="page"/></w:r></w:p>` +
+		// Word records the break it rendered right after the explicit one
+		`<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:lastRenderedPageBreak/><w:t>1 Results</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>Sales went up.</w:t></w:r></w:p>` +
+		`<w:p><w:pPr><w:pageBreakBefore/><w:outlineLvl w:val="1"/></w:pPr><w:r><w:t>1.1 Outlook</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>More of the same.</w:t></w:r></w:p>`
+
+	text, err := docxText(wordDocument(t, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(text)
+	want := "Annual Report\nPrepared by\tthe board\n1 Results\nSales went up.\n1.1 Outlook\nMore of the same."
+	if string(data) != want {
+		t.Fatalf("expected %q, got %q", want, data)
+	}
+
+	places := []struct {
+		text    string
+		page    int
+		section string
+	}{
+		{"Annual", 1, "Annual Report"},
+		{"the board", 1, "Annual Report"},
+		{"1 Results", 2, "1 Results"},
+		{"Sales", 2, "1 Results"},
+		{"1.1 Outlook", 3, "1.1 Outlook"},
+		{"same", 3, "1.1 Outlook"},
+	}
+	for _, p := range places {
+		offset := strings.Index(want, p.text)
+		if page, section := text.Page(offset), text.Section(offset); page != p.page || section != p.section {
+			t.Errorf("%q: expected page %d in %q, got page %d in %q", p.text, p.page, p.section, page, section)
+		}
+	}
+}
+
+// Test that the pages of a Word document that was never laid out are not known
+func TestDocxText_NoPages(t *testing.T) {
+	text, err := docxText(wordDocument(t, `<w:p><w:r><w:t>just text</w:t></w:r></w:p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page, section := text.Page(0), text.Section(0); page != 0 || section != "" {
+		t.Errorf("expected no page or section, got page %d in %q", page, section)
+	}
+}
+
+// Test which lines of PDF text are taken for section headings
+func TestPdfHeading(t *testing.T) {
+	tests := map[string]bool{
+		"4.2 Results\n":                      true,
+		"  3. Method":                        true,
+		"12 Über die Messung":                true,
+		"4.2 Results ........ 37":            false, // a table of contents
+		"1. Buy milk.":                       false, // a list
+		"2 apples and 3 pears":               false,
+		"2024 Annual Report":                 false,
+		"Results":                            false,
+		"4.2 " + strings.Repeat("Long ", 20): false,
+	}
+	for line, want := range tests {
+		if got := pdfHeading(line); got != want {
+			t.Errorf("pdfHeading(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+// Test that pages and headings move with the whitespace trimmed from the text
+func TestPageBuilder_Trimmed(t *testing.T) {
+	var b pageBuilder
+	b.text.WriteString("\n\n")
+	b.pages = append(b.pages, 0)
+	b.text.WriteString("\n") // an empty first page
+	b.pages = append(b.pages, b.text.Len())
+	b.heading(b.text.Len(), "  1   Start ")
+	b.text.WriteString("1 Start\nbody\n")
+	b.pages = append(b.pages, b.text.Len())
+	b.text.WriteString("end\n\n")
+
+	text := b.paged()
+	data, _ := io.ReadAll(text)
+	if string(data) != "1 Start\nbody\nend" {
+		t.Fatalf("unexpected text %q", data)
+	}
+	if text.Page(0) != 2 || text.Page(13) != 3 || text.Section(0) != "1 Start" {
+		t.Errorf("expected the text on pages 2 and 3 in section %q, got pages %d and %d in %q",
+			"1 Start", text.Page(0), text.Page(13), text.Section(0))
+	}
+}
@@ -0,0 +1,341 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Formats of the records SplitRecords reads, see RecordFormat
+const (
+	FormatCSV   = "csv"   // comma-separated values, the first row naming the columns
+	FormatTSV   = "tsv"   // tab-separated values, the first row naming the columns
+	FormatJSONL = "jsonl" // one JSON object per line
+	FormatLines = "lines" // anything else: every line is a record
+)
+
+// RecordFormat returns the format of the records of the file called name, told from its
+// extension once compression is stripped: .csv, .tsv or .tab, .jsonl or .ndjson, and
+// FormatLines for anything else
+func RecordFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(uncompressedName(name))) {
+	case ".csv":
+		return FormatCSV
+	case ".tsv", ".tab":
+		return FormatTSV
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	default:
+		return FormatLines
+	}
+}
+
+// RecordOptions selects what of a record is hashed, and what identifies it
+type RecordOptions struct {
+	// Fields are the columns or JSON fields whose values are hashed, all of them if empty.
+	// A column is named by its header, or by its number from 1 if no column has that
+	// name; a field of a nested object by its path, as in "user.name".
+	Fields []string
+
+	// Key is the column or field whose value identifies a record, "" for none
+	Key string
+
+	// OnInvalid, if set, is called with the line number and the error of every line of
+	// JSON lines that isn't a JSON object. The line is left out and the rest is read.
+	OnInvalid func(line int, err error)
+}
+
+// Record is a row of a CSV or TSV file, an object of a JSON lines file or a line of
+// any other text, see SplitRecords
+type Record struct {
+	Offset   int      // byte offset of the record in the stream
+	Size     int      // length of the record in bytes, without the line break that ends it
+	Text     []byte   // the values of the selected fields, one per line: the text that is hashed
+	Location Location // the lines of the record, and its number and key
+}
+
+// SplitRecords reads records in the given format (see RecordFormat) from r and calls emit
+// for every one, in order, until emit returns an error. Records are numbered from 1, not
+// counting the header row; blank lines are not records, and records whose selected
+// fields are all empty, like lines of JSON lines that don't hold an object (see
+// RecordOptions.OnInvalid), are numbered but not emitted.
+//
+// Only the record being read is held in memory.
+func SplitRecords(r io.Reader, format string, opts RecordOptions, emit func(Record) error) error {
+	switch format {
+	case FormatCSV:
+		return splitDelimited(r, ',', opts, emit)
+	case FormatTSV:
+		return splitDelimited(r, '\t', opts, emit)
+	case FormatJSONL:
+		return splitLines(r, func(line []byte) ([]string, string, error) { return jsonRecord(line, opts) }, opts.OnInvalid, emit)
+	case FormatLines:
+		return splitLines(r, func(line []byte) ([]string, string, error) { return []string{string(line)}, "", nil }, nil, emit)
+	default:
+		return fmt.Errorf("unknown record format %q", format)
+	}
+}
+
+// emitRecord locates the record of data, which starts at offset and is numbered number,
+// and emits it unless its values are all blank
+func emitRecord(locator *Locator, offset int, data []byte, number int, values []string, key string, emit func(Record) error) error {
+	location, err := locator.Locate(offset, data)
+	if err != nil {
+		return err
+	}
+	location.Record, location.Key = number, key
+
+	text := strings.Join(values, "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	return emit(Record{
+		Offset:   offset,
+		Size:     len(bytes.TrimRight(data, "\r\n")),
+		Text:     []byte(text),
+		Location: location,
+	})
+}
+
+// splitLines emits every line of r that isn't blank as a record, with the values and
+// the key parse finds in it. A line parse fails on is passed to onInvalid and left out.
+func splitLines(r io.Reader, parse func(line []byte) ([]string, string, error), onInvalid func(int, error), emit func(Record) error) error {
+	br := bufio.NewReader(r)
+	var locator Locator
+	offset, number := 0, 0
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		located := false
+		if content := bytes.TrimSpace(data); len(content) > 0 {
+			number++
+			values, key, perr := parse(content)
+			if perr == nil {
+				if err := emitRecord(&locator, offset, data, number, values, key, emit); err != nil {
+					return err
+				}
+				located = true
+			} else if onInvalid != nil {
+				onInvalid(line, perr)
+			}
+		}
+		// keep the locator counting lines over blank lines and lines left out
+		if !located && len(data) > 0 {
+			if _, err := locator.Locate(offset, data); err != nil {
+				return err
+			}
+		}
+		offset += len(data)
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// splitDelimited emits every row of CSV or TSV data after the header row
+func splitDelimited(r io.Reader, comma rune, opts RecordOptions, emit func(Record) error) error {
+	raw := &rawReader{r: r}
+	cr := csv.NewReader(raw)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the header row: %w", err)
+	}
+	fields := make([]int, len(opts.Fields))
+	for i, name := range opts.Fields {
+		if fields[i], err = column(header, name); err != nil {
+			return err
+		}
+	}
+	key := -1
+	if opts.Key != "" {
+		if key, err = column(header, opts.Key); err != nil {
+			return err
+		}
+	}
+
+	var locator Locator
+	end := int(cr.InputOffset())
+	if _, err := locator.Locate(0, raw.take(end)); err != nil {
+		return err
+	}
+	for number := 1; ; number++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start := end
+		end = int(cr.InputOffset())
+		data := raw.take(end - start)
+
+		// the reader skips blank lines before a row
+		if blank := len(data) - len(bytes.TrimLeft(data, "\r\n")); blank > 0 {
+			if _, err := locator.Locate(start, data[:blank]); err != nil {
+				return err
+			}
+			start, data = start+blank, data[blank:]
+		}
+
+		values := row
+		if len(fields) > 0 {
+			values = make([]string, len(fields))
+			for i, f := range fields {
+				values[i] = cell(row, f)
+			}
+		}
+		if err := emitRecord(&locator, start, data, number, values, cell(row, key), emit); err != nil {
+			return err
+		}
+	}
+}
+
+// column returns the index of the column called name, or numbered name from 1
+func column(header []string, name string) (int, error) {
+	for i, h := range header {
+		if strings.TrimSpace(h) == name {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(header) {
+		return n - 1, nil
+	}
+	return 0, fmt.Errorf("no column %q in the header row (%s)", name, strings.Join(header, ", "))
+}
+
+// cell returns the i-th value of row, "" if the row is shorter or i is -1
+func cell(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
+
+// rawReader keeps the bytes read through it until they are taken, so the bytes of every
+// row can be had after a csv.Reader has parsed it
+type rawReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (rr *rawReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.buf = append(rr.buf, p[:n]...)
+	return n, err
+}
+
+// take returns the next n bytes read and forgets them
+func (rr *rawReader) take(n int) []byte {
+	data := bytes.Clone(rr.buf[:n])
+	rr.buf = rr.buf[:copy(rr.buf, rr.buf[n:])]
+	return data
+}
+
+// jsonField is a field of a JSON object
+type jsonField struct {
+	name  string
+	value json.RawMessage
+}
+
+// jsonRecord returns the values of the selected fields of the JSON object on a line, all
+// of its fields in order if none are selected, and the value of its key
+func jsonRecord(line []byte, opts RecordOptions) ([]string, string, error) {
+	fields, err := jsonFields(line)
+	if err != nil {
+		return nil, "", err
+	}
+	var values []string
+	if len(opts.Fields) == 0 {
+		for _, f := range fields {
+			values = append(values, jsonText(f.value))
+		}
+	} else {
+		for _, name := range opts.Fields {
+			values = append(values, jsonText(jsonPath(fields, name)))
+		}
+	}
+	key := ""
+	if opts.Key != "" {
+		key = jsonText(jsonPath(fields, opts.Key))
+	}
+	return values, key, nil
+}
+
+// jsonFields returns the fields of a JSON object in the order they are written in
+func jsonFields(data []byte) ([]jsonField, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+	var fields []jsonField
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		var f jsonField
+		f.name, _ = token.(string)
+		if err := decoder.Decode(&f.value); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		fields = append(fields, f)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return fields, nil
+}
+
+// jsonPath returns the value of the field at path, which names a field or, with dots,
+// a field of a nested object. It returns nil if there is no such field.
+func jsonPath(fields []jsonField, path string) json.RawMessage {
+	for _, f := range fields {
+		if f.name == path {
+			return f.value
+		}
+	}
+	for _, f := range fields {
+		if rest, ok := strings.CutPrefix(path, f.name+"."); ok {
+			if nested, err := jsonFields(f.value); err == nil {
+				if value := jsonPath(nested, rest); value != nil {
+					return value
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonText returns a JSON value as text: a string as it is, null and a missing value as
+// "", anything else as compact JSON
+func jsonText(value json.RawMessage) string {
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		return s
+	}
+	if value == nil || string(value) == "null" {
+		return ""
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, value) != nil {
+		return string(value)
+	}
+	return compact.String()
+}
@@ -0,0 +1,131 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecordFormat(t *testing.T) {
+	tests := map[string]string{
+		"export.csv":           FormatCSV,
+		"EXPORT.CSV.gz":        FormatCSV,
+		"data.tsv":             FormatTSV,
+		"data.tab":             FormatTSV,
+		"app.jsonl":            FormatJSONL,
+		"logs.zip!/app.ndjson": FormatJSONL,
+		"notes.txt":            FormatLines,
+		"stdin":                FormatLines,
+	}
+	for name, want := range tests {
+		if got := RecordFormat(name); got != want {
+			t.Errorf("RecordFormat(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+// splitRecords returns the records SplitRecords emits for input
+func splitRecords(t *testing.T, input, format string, opts RecordOptions) []Record {
+	t.Helper()
+	var records []Record
+	err := SplitRecords(strings.NewReader(input), format, opts, func(r Record) error {
+		if r.Offset+r.Size > len(input) {
+			t.Fatalf("record %d ends at %d, after the input", r.Location.Record, r.Offset+r.Size)
+		}
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// Test that every row of CSV data is a record, hashed by the selected columns and
+// recorded by its bytes and lines
+func TestSplitRecords_CSV(t *testing.T) {
+	input := "id,name,city\n" +
+		"7,Ada,London\n" +
+		"\n" +
+		"8,\"Charles\nBabbage\",London\n" +
+		"9,,\n" +
+		"10,Mary,Paris"
+	records := splitRecords(t, input, FormatCSV, RecordOptions{Fields: []string{"name", "3"}, Key: "id"})
+
+	want := []struct {
+		row, text, key string
+		number, line   int
+	}{
+		{"7,Ada,London", "Ada\nLondon", "7", 1, 2},
+		{"8,\"Charles\nBabbage\",London", "Charles\nBabbage\nLondon", "8", 2, 4},
+		// row 3 has no name or city, so it isn't hashed
+		{"10,Mary,Paris", "Mary\nParis", "10", 4, 7},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %+v", len(want), records)
+	}
+	for i, w := range want {
+		r := records[i]
+		if row := input[r.Offset : r.Offset+r.Size]; row != w.row {
+			t.Errorf("record %d: expected row %q, got %q", i, w.row, row)
+		}
+		if string(r.Text) != w.text || r.Location.Key != w.key || r.Location.Record != w.number || r.Location.Line != w.line {
+			t.Errorf("record %d: expected %q, key %s, number %d on line %d, got %q, key %s, number %d on line %d",
+				i, w.text, w.key, w.number, w.line, r.Text, r.Location.Key, r.Location.Record, r.Location.Line)
+		}
+	}
+
+	// every column without fields, and tabs for TSV
+	records = splitRecords(t, "a\tb\nx y\tz\n", FormatTSV, RecordOptions{})
+	if len(records) != 1 || string(records[0].Text) != "x y\nz" || records[0].Location.Key != "" {
+		t.Errorf("expected one record of both columns, got %+v", records)
+	}
+
+	err := SplitRecords(strings.NewReader(input), FormatCSV, RecordOptions{Key: "email"}, func(Record) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), `no column "email"`) {
+		t.Errorf("Expected an error naming the missing column, got %v", err)
+	}
+}
+
+// Test that every object of JSON lines is a record, hashed by the selected fields
+func TestSplitRecords_JSONL(t *testing.T) {
+	input := `{"id": "a1", "user": {"name": "Ada"}, "msg": "disk full", "n": 3}` + "\n" +
+		"\n" +
+		`{"id": 2, "msg": "disk full again", "tags": ["x", "y"]}` + "\n"
+
+	records := splitRecords(t, input, FormatJSONL, RecordOptions{Fields: []string{"user.name", "msg"}, Key: "id"})
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %+v", records)
+	}
+	if string(records[0].Text) != "Ada\ndisk full" || records[0].Location.Key != "a1" || records[0].Location.Record != 1 {
+		t.Errorf("unexpected first record %+v", records[0])
+	}
+	// a missing field is empty, and a key needn't be a string
+	if string(records[1].Text) != "\ndisk full again" || records[1].Location.Key != "2" || records[1].Location.Line != 3 {
+		t.Errorf("unexpected second record %+v", records[1])
+	}
+
+	// every field, in the order they are written in
+	records = splitRecords(t, input, FormatJSONL, RecordOptions{})
+	if string(records[1].Text) != "2\ndisk full again\n[\"x\",\"y\"]" {
+		t.Errorf("expected every field of the record, got %q", records[1].Text)
+	}
+
+	// a line that isn't an object is reported and left out, and the rest is read
+	var invalid []int
+	opts := RecordOptions{Key: "id", OnInvalid: func(line int, err error) { invalid = append(invalid, line) }}
+	records = splitRecords(t, input+"oops\n"+`{"id": "z"}`+"\n", FormatJSONL, opts)
+	if len(invalid) != 1 || invalid[0] != 4 {
+		t.Errorf("Expected line 4 reported, got %v", invalid)
+	}
+	if len(records) != 3 || records[2].Location.Key != "z" || records[2].Location.Record != 4 || records[2].Location.Line != 5 {
+		t.Errorf("Expected the record after the bad line, got %+v", records)
+	}
+}
+
+// Test that every line of other text is a record
+func TestSplitRecords_Lines(t *testing.T) {
+	records := splitRecords(t, "first line\n\n  second line  \n", FormatLines, RecordOptions{})
+	if len(records) != 2 || string(records[1].Text) != "second line" || records[1].Location.Record != 2 || records[1].Offset != 12 {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
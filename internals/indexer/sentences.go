@@ -0,0 +1,171 @@
+package indexer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// abbreviations end with a period that doesn't end the sentence ("Mr. Smith", "etc. and")
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true,
+	"st": true, "mt": true, "rev": true, "gen": true, "col": true, "capt": true, "lt": true,
+	"sgt": true, "hon": true, "gov": true, "pres": true, "messrs": true,
+	"vs": true, "etc": true, "al": true, "cf": true, "approx": true, "viz": true,
+	"inc": true, "ltd": true, "co": true, "corp": true, "dept": true, "univ": true,
+	"no": true, "nos": true, "vol": true, "vols": true, "fig": true, "figs": true,
+	"p": true, "pp": true, "ch": true, "sec": true, "ed": true, "eds": true, "op": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true, "aug": true,
+	"sep": true, "sept": true, "oct": true, "nov": true, "dec": true,
+}
+
+// sentenceBoundaries returns the start of every sentence in text except the first.
+//
+// It is a rule-based segmenter:
+//   - a sentence ends at '.', '!', '?' or '…', together with any closing quotes and
+//     brackets after it, when whitespace follows
+//   - CJK full stops ('。', '！', '？') end a sentence with or without whitespace
+//   - it doesn't end when the next word starts with a lowercase letter ("etc. and so on",
+//     "\"Run!\" he said")
+//   - a period doesn't end the sentence after a known abbreviation ("Dr."), a single
+//     letter ("J. R. R. Tolkien"), or a dotted abbreviation ("e.g.", "U.S.")
+//   - a blank line always ends a sentence, so headings and list items without
+//     punctuation are sentences of their own
+//
+// The boundary is the start of the next sentence, after the whitespace.
+func sentenceBoundaries(text []byte) []int {
+	var bounds []int
+	s := string(text)
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\n':
+			// a blank line ends the sentence wherever it is
+			end := skipSpace(s, i)
+			if strings.Count(s[i:end], "\n") >= 2 && end < len(s) {
+				bounds = appendBound(bounds, end)
+			}
+			i = end
+			continue
+
+		case isCJKTerminal(r):
+			end := skipClosers(s, skipTerminals(s, i))
+			next := skipSpace(s, end)
+			if next < len(s) {
+				bounds = appendBound(bounds, next)
+			}
+			i = next
+			continue
+
+		case isTerminal(r):
+			end := skipClosers(s, skipTerminals(s, i))
+			next := skipSpace(s, end)
+			if next == end || next == len(s) {
+				// no whitespace after it ("3.14", "example.com"), or we can't see what follows
+				i = end
+				continue
+			}
+			if startsLower(s[next:]) || (r == '.' && end-i == 1 && isAbbreviation(s[:i])) {
+				i = end
+				continue
+			}
+			bounds = appendBound(bounds, next)
+			i = next
+			continue
+		}
+		i += size
+	}
+	return bounds
+}
+
+// isAbbreviation reports whether a period after before belongs to an abbreviation
+func isAbbreviation(before string) bool {
+	word := lastWord(before)
+	if abbreviations[strings.ToLower(word)] {
+		return true
+	}
+	if utf8.RuneCountInString(word) == 1 && unicode.IsLetter(firstRune(word)) && word != "I" {
+		return true // an initial
+	}
+	return strings.Contains(word, ".") // "e.g", "U.S"
+}
+
+// startsLower reports whether the next word starts with a lowercase letter, which
+// means the sentence goes on ("etc. and so on", "\"Run!\" he said")
+func startsLower(after string) bool {
+	return unicode.IsLower(firstRune(strings.TrimLeft(after, "\"'“‘([«")))
+}
+
+// lastWord returns the run of letters, digits and periods at the end of s
+func lastWord(s string) string {
+	start := len(s)
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(s[:start])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' {
+			break
+		}
+		start -= size
+	}
+	return s[start:]
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func appendBound(bounds []int, b int) []int {
+	if len(bounds) > 0 && bounds[len(bounds)-1] == b {
+		return bounds
+	}
+	return append(bounds, b)
+}
+
+func isTerminal(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == '…'
+}
+
+func isCJKTerminal(r rune) bool {
+	return r == '。' || r == '！' || r == '？'
+}
+
+func isCloser(r rune) bool {
+	return strings.ContainsRune("\"')]}»”’」』", r)
+}
+
+// skipTerminals skips a run of sentence-ending punctuation ("?!", "...") starting at i
+func skipTerminals(s string, i int) int {
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !isTerminal(r) && !isCJKTerminal(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// skipClosers skips closing quotes and brackets starting at i
+func skipClosers(s string, i int) int {
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !isCloser(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// skipSpace skips whitespace starting at i
+func skipSpace(s string, i int) int {
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
@@ -0,0 +1,74 @@
+package indexer
+
+import (
+	"slices"
+	"testing"
+)
+
+// splitSentences splits text at sentenceBoundaries
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for _, b := range sentenceBoundaries([]byte(text)) {
+		sentences = append(sentences, text[start:b])
+		start = b
+	}
+	return append(sentences, text[start:])
+}
+
+func TestSentenceBoundaries(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			"simple",
+			"The wolf howled. The pack answered! Did Mowgli hear? Yes.",
+			[]string{"The wolf howled. ", "The pack answered! ", "Did Mowgli hear? ", "Yes."},
+		},
+		{
+			"abbreviations and initials",
+			"Mr. Kipling met Dr. Watson in St. Albans. J. R. R. Tolkien was not there.",
+			[]string{"Mr. Kipling met Dr. Watson in St. Albans. ", "J. R. R. Tolkien was not there."},
+		},
+		{
+			"dotted abbreviations and numbers",
+			"Prices rose 3.5 percent, e.g. in the U.S. market. Then they fell.",
+			[]string{"Prices rose 3.5 percent, e.g. in the U.S. market. ", "Then they fell."},
+		},
+		{
+			"lowercase continuation",
+			"Bring wolves, bears, etc. and anything else. Go.",
+			[]string{"Bring wolves, bears, etc. and anything else. ", "Go."},
+		},
+		{
+			"quotes and ellipsis",
+			"\"Silence, thou man's cub!\" said Shere Khan... \"Let him speak.\" Then he spoke.",
+			[]string{"\"Silence, thou man's cub!\" said Shere Khan... ", "\"Let him speak.\" ", "Then he spoke."},
+		},
+		{
+			"pronoun I",
+			"So did I. Then we left.",
+			[]string{"So did I. ", "Then we left."},
+		},
+		{
+			"blank lines",
+			"CHAPTER ONE\n\nMowgli's Brothers\n\nNow Rann the Kite brings home the night",
+			[]string{"CHAPTER ONE\n\n", "Mowgli's Brothers\n\n", "Now Rann the Kite brings home the night"},
+		},
+		{
+			"CJK",
+			"狼来了。他跑了！为什么？",
+			[]string{"狼来了。", "他跑了！", "为什么？"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSentences(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Splitter divides a stream of text into chunks.
+//
+// Split reads r sequentially and calls emit for every chunk, in order, with the chunk's
+// byte offset in the stream. emit owns data: a splitter never reuses a chunk's buffer.
+// If emit returns an error, Split stops and returns it.
+//
+// Splitters only hold the chunk they are reading, so memory use doesn't depend on the
+// size of the input; whoever receives the chunks decides how many are in flight.
+type Splitter interface {
+	Split(r io.Reader, emit func(offset int, data []byte) error) error
+}
+
+// FixedSplitter cuts the stream into chunks of exactly Size bytes; the last one may be shorter.
+//
+// With a Stride below Size the chunks are overlapping windows: a chunk of Size bytes
+// starts every Stride bytes, so text near the end of one chunk is also in the middle
+// of the next. The last window ends at the end of the input.
+type FixedSplitter struct {
+	Size   int
+	Stride int // bytes between the starts of two chunks; 0 means Size, no overlap
+}
+
+// Split implements Splitter
+func (s FixedSplitter) Split(r io.Reader, emit func(offset int, data []byte) error) error {
+	if s.Size <= 0 {
+		return fmt.Errorf("invalid chunk size: %d", s.Size)
+	}
+	stride := s.Stride
+	if stride == 0 {
+		stride = s.Size
+	}
+	if stride < 0 || stride > s.Size {
+		return fmt.Errorf("invalid stride %d for chunk size %d", s.Stride, s.Size)
+	}
+
+	window := make([]byte, 0, s.Size)
+	offset := 0
+	for {
+		n, err := io.ReadFull(r, window[len(window):s.Size])
+		window = window[:len(window)+n]
+		eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !eof {
+			return err
+		}
+		if n == 0 {
+			// nothing past the previous window
+			return nil
+		}
+
+		chunk := make([]byte, len(window))
+		copy(chunk, window)
+		if err := emit(offset, chunk); err != nil {
+			return err
+		}
+		if eof {
+			return nil
+		}
+		window = window[:copy(window, window[stride:])]
+		offset += stride
+	}
+}
+
+// splitWindows is the read loop of the splitters that look at the data to decide where
+// a chunk ends. It keeps a buffer of up to window bytes topped up from r, asks cut where
+// the next chunk ends (eof is set once the buffer holds the rest of the input), emits a
+// copy of that chunk and moves the rest of the buffer to the front.
+func splitWindows(r io.Reader, window int, cut func(buf []byte, eof bool) int, emit func(offset int, data []byte) error) error {
+	buf := make([]byte, 0, window)
+	offset := 0
+	eof := false
+	for {
+		for !eof && len(buf) < window {
+			n, err := r.Read(buf[len(buf):window])
+			buf = buf[:len(buf)+n]
+			if errors.Is(err, io.EOF) {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if len(buf) == 0 {
+			return nil
+		}
+
+		n := cut(buf, eof)
+		chunk := make([]byte, n)
+		copy(chunk, buf[:n])
+		if err := emit(offset, chunk); err != nil {
+			return err
+		}
+		offset += n
+		buf = buf[:copy(buf, buf[n:])]
+	}
+}
+
+// collectChunks splits r and keeps every chunk, for callers that need them all at once
+func collectChunks(r io.Reader, splitter Splitter) ([][]byte, error) {
+	var chunks [][]byte
+	err := splitter.Split(r, func(_ int, data []byte) error {
+		chunks = append(chunks, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
@@ -0,0 +1,113 @@
+package indexer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// countingReader counts how many bytes have been read from it
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+// TestFixedSplitter checks chunk offsets and sizes, including a short last chunk
+func TestFixedSplitter(t *testing.T) {
+	input := strings.Repeat("0123456789", 25) // 250 bytes
+	var offsets, sizes []int
+	var joined bytes.Buffer
+
+	err := FixedSplitter{Size: 100}.Split(strings.NewReader(input), func(offset int, data []byte) error {
+		offsets = append(offsets, offset)
+		sizes = append(sizes, len(data))
+		joined.Write(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int{0, 100, 200}; !slices.Equal(offsets, want) {
+		t.Errorf("Expected offsets %v, got %v", want, offsets)
+	}
+	if want := []int{100, 100, 50}; !slices.Equal(sizes, want) {
+		t.Errorf("Expected sizes %v, got %v", want, sizes)
+	}
+	if joined.String() != input {
+		t.Error("Expected the chunks to add up to the input")
+	}
+}
+
+// TestFixedSplitter_Stride checks that overlapping windows start every Stride bytes and
+// that the last one ends at the end of the input
+func TestFixedSplitter_Stride(t *testing.T) {
+	input := strings.Repeat("0123456789", 25) // 250 bytes
+	var offsets []int
+
+	err := FixedSplitter{Size: 100, Stride: 40}.Split(strings.NewReader(input), func(offset int, data []byte) error {
+		if string(data) != input[offset:min(offset+100, len(input))] {
+			t.Errorf("chunk at %d doesn't match the input", offset)
+		}
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 40, 80, 120, 160}; !slices.Equal(offsets, want) {
+		t.Errorf("Expected offsets %v, got %v", want, offsets)
+	}
+
+	if err := (FixedSplitter{Size: 10, Stride: 20}).Split(strings.NewReader(input), func(int, []byte) error { return nil }); err == nil {
+		t.Error("Expected an error for a stride longer than the chunk size, but found none")
+	}
+}
+
+// TestFixedSplitter_Streams checks that the splitter never reads more than one chunk ahead
+func TestFixedSplitter_Streams(t *testing.T) {
+	const size = 4096
+	reader := &countingReader{r: bytes.NewReader(make([]byte, 1<<20))}
+
+	err := FixedSplitter{Size: size}.Split(reader, func(offset int, data []byte) error {
+		if ahead := reader.read - offset; ahead > size {
+			t.Fatalf("read %d bytes past the chunk at %d", ahead, offset)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFixedSplitter_Errors checks that emit and read errors stop the split
+func TestFixedSplitter_Errors(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := FixedSplitter{Size: 10}.Split(strings.NewReader(strings.Repeat("x", 100)), func(int, []byte) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("Expected the emit error after one chunk, got %v after %d", err, calls)
+	}
+
+	failing := io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(errors.New("disk on fire")))
+	if err := (FixedSplitter{Size: 10}).Split(failing, func(int, []byte) error { return nil }); err == nil {
+		t.Error("Expected the read error, but found none")
+	}
+
+	if err := (FixedSplitter{}).Split(strings.NewReader("abc"), func(int, []byte) error { return nil }); err == nil {
+		t.Error("Expected an error for a zero chunk size, but found none")
+	}
+}
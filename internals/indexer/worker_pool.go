@@ -10,6 +10,8 @@ type Task struct {
 	ID         int
 	Data       []byte
 	Offset     int
+	Size       int // size of the chunk in its source, which differs from len(Data) for decoded text
+	Location   Location
 	SourceFile string
 }
 
@@ -18,6 +20,8 @@ type SimHashResult struct {
 	Hash       uint64
 	Data       []byte
 	Offset     int
+	Size       int
+	Location   Location
 	SourceFile string
 }
 
@@ -33,6 +37,7 @@ type SimHashWorker struct {
 type WorkerPool struct {
 	workers    []*SimHashWorker
 	numWorkers int
+	featureSet simhash.FeatureSet
 	tasks      chan Task
 	results    chan SimHashResult
 	wg         sync.WaitGroup
@@ -47,16 +52,30 @@ type WorkerPool struct {
 // Returns:
 //   - *WorkerPool: A new worker pool instance ready to be started
 func NewSimHashWorkerPool(numWorkers int) *WorkerPool {
+	return NewSimHashWorkerPoolWithFeatures(numWorkers, DefaultFeatureSet())
+}
+
+// NewSimHashWorkerPoolWithFeatures creates a worker pool whose workers break chunks
+// into features with featureSet instead of the default word feature set.
+func NewSimHashWorkerPoolWithFeatures(numWorkers int, featureSet simhash.FeatureSet) *WorkerPool {
 	return &WorkerPool{
 		workers:    make([]*SimHashWorker, numWorkers),
 		numWorkers: numWorkers,
+		featureSet: featureSet,
 		tasks:      make(chan Task, numWorkers*2),
 		results:    make(chan SimHashResult, numWorkers*2),
 	}
 }
 
+// DefaultFeatureSet returns the feature set the worker pool fingerprints chunks with.
+// Anything that hashes text to compare against an index (query text, the hash command)
+// has to go through the same feature set, otherwise the fingerprints won't line up.
+func DefaultFeatureSet() simhash.FeatureSet {
+	return simhash.NewWordFeatureSet()
+}
+
 func (p *WorkerPool) Start() {
-	featureSet := simhash.NewWordFeatureSet()
+	featureSet := p.featureSet
 
 	for i := range p.numWorkers {
 		p.wg.Add(1)
@@ -111,6 +130,8 @@ func (w *SimHashWorker) run() {
 				Hash:       hash,
 				Data:       task.Data,
 				Offset:     task.Offset,
+				Size:       task.Size,
+				Location:   task.Location,
 				SourceFile: task.SourceFile,
 			}
 			w.results <- result
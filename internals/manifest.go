@@ -0,0 +1,242 @@
+package internals
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	idx "github.com/bravian1/Textblitz/internals/indexer"
+)
+
+// FileRecord is what an index remembers about a source file it was built from,
+// so that an update can tell whether the file changed since
+type FileRecord struct {
+	Path     string
+	Size     int64
+	ModTime  int64  // modification time, in nanoseconds since the Unix epoch
+	Checksum string // SHA-256 of the file contents, in hex
+}
+
+// UpdateSummary counts what UpdateFiles did with each file
+type UpdateSummary struct {
+	Added     int // new files, indexed
+	Changed   int // modified files, indexed again
+	Removed   int // files no longer in the input, whose entries were dropped
+	Unchanged int // files left as they were
+	Touched   int // unchanged files whose modification time moved, recorded again
+}
+
+// Modified reports whether the update changed anything that needs saving
+func (s UpdateSummary) Modified() bool {
+	return s.Added+s.Changed+s.Removed+s.Touched > 0
+}
+
+// statFile records the size, modification time and checksum of a file
+func statFile(path string) (FileRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return FileRecord{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return FileRecord{}, err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return FileRecord{}, err
+	}
+	return FileRecord{
+		Path:     path,
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// Files returns the records of the source files the index was built from, sorted by path.
+// Indexes written before files were recorded, and gob indexes, have none.
+func (im *IndexManager) Files() []FileRecord {
+	files := make([]FileRecord, 0, len(im.files))
+	for _, record := range im.files {
+		files = append(files, record)
+	}
+	slices.SortFunc(files, func(a, b FileRecord) int {
+		switch {
+		case a.Path < b.Path:
+			return -1
+		case a.Path > b.Path:
+			return 1
+		}
+		return 0
+	})
+	return files
+}
+
+// setFile records a source file of the index
+func (im *IndexManager) setFile(record FileRecord) {
+	if im.files == nil {
+		im.files = make(map[string]FileRecord)
+	}
+	im.files[record.Path] = record
+}
+
+// UpdateFiles brings the index up to date with files, the complete list of files it
+// should cover, without indexing again the files that haven't changed:
+//   - files the index doesn't know are indexed and added
+//   - files whose size or modification time changed are checksummed; if the contents
+//     changed, their entries are dropped and the file is indexed again
+//   - entries of files that are no longer in the list (deleted, or now excluded) are dropped
+//
+// The files are chunked and hashed with the options in the index header, so they
+// line up with the rest of the index; only the worker counts of opts are used.
+func (im *IndexManager) UpdateFiles(ctx context.Context, files []string, opts IndexOptions) (UpdateSummary, error) {
+	var summary UpdateSummary
+	if !im.header.Known() {
+		return summary, fmt.Errorf("the index has no header recording how it was built; rebuild it instead of updating it")
+	}
+	if err := im.materialize(); err != nil {
+		return summary, err
+	}
+	if err := im.checkSources(); err != nil {
+		return summary, err
+	}
+	// none of the documents were extracted the old way, so the ones indexed now are the new way
+	im.header.Extractor = ExtractorVersion
+	opts = im.header.IndexOptions(opts)
+
+	indexed := im.indexedFiles()
+	wanted := make(map[string]bool, len(files))
+	var reindex, stale []string
+	for _, file := range files {
+		wanted[file] = true
+		record, known := im.files[file]
+		switch {
+		case !known && !indexed[file]:
+			summary.Added++
+			reindex = append(reindex, file)
+		case !known:
+			// indexed before files were recorded, so there is nothing to compare with
+			summary.Changed++
+			reindex = append(reindex, file)
+			stale = append(stale, file)
+		default:
+			current, err := im.compareFile(record)
+			switch {
+			case err != nil || current.Checksum != record.Checksum:
+				summary.Changed++
+				reindex = append(reindex, file)
+				stale = append(stale, file)
+			case current != record:
+				summary.Touched++
+				summary.Unchanged++
+				im.setFile(current)
+			default:
+				summary.Unchanged++
+			}
+		}
+	}
+	for file := range indexed {
+		if !wanted[file] {
+			summary.Removed++
+			stale = append(stale, file)
+		}
+	}
+
+	fresh := NewIndexManager()
+	if err := fresh.IndexFiles(ctx, reindex, opts); err != nil {
+		return summary, err
+	}
+	im.removeFiles(stale)
+	if err := im.addAll(fresh); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// checkSources returns an error if the index has chunks of a file that can't be read
+// back from it, see IndexHeader.CheckSource
+func (im *IndexManager) checkSources() error {
+	for _, entries := range im.index {
+		for _, entry := range entries {
+			if err := im.header.CheckSource(entry.OriginalFile); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compareFile returns the current record of a file. The checksum is only computed
+// again if the size or modification time changed; otherwise record is returned.
+func (im *IndexManager) compareFile(record FileRecord) (FileRecord, error) {
+	info, err := os.Stat(record.Path)
+	if err != nil {
+		return FileRecord{}, err
+	}
+	if info.Size() == record.Size && info.ModTime().UnixNano() == record.ModTime {
+		return record, nil
+	}
+	return statFile(record.Path)
+}
+
+// indexedFiles returns every source file the index has entries or a record for.
+// An archive is returned for the files inside it.
+func (im *IndexManager) indexedFiles() map[string]bool {
+	files := make(map[string]bool, len(im.files))
+	for path := range im.files {
+		files[path] = true
+	}
+	for _, entries := range im.index {
+		for _, entry := range entries {
+			files[sourcePath(entry.OriginalFile)] = true
+		}
+	}
+	return files
+}
+
+// sourcePath returns the file on disk the chunks of an entry labelled file come from:
+// the archive for a file inside one, see idx.SplitMember
+func sourcePath(file string) string {
+	if archive, _, ok := idx.SplitMember(file); ok {
+		return archive
+	}
+	return file
+}
+
+// removeFiles drops the entries and records of the given source files.
+// Dropping an archive drops the entries of every file inside it.
+func (im *IndexManager) removeFiles(files []string) int {
+	if len(files) == 0 {
+		return 0
+	}
+	drop := make(map[string]bool, len(files))
+	for _, file := range files {
+		drop[file] = true
+		delete(im.files, file)
+	}
+
+	removed := 0
+	for key, entries := range im.index {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if drop[entry.OriginalFile] || drop[sourcePath(entry.OriginalFile)] {
+				removed++
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		if len(kept) == 0 {
+			delete(im.index, key)
+		} else {
+			im.index[key] = kept
+		}
+	}
+	im.invalidate()
+	return removed
+}
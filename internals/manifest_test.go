@@ -0,0 +1,102 @@
+package internals
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// indexedPaths returns the source files that have entries in the index
+func indexedPaths(im *IndexManager) []string {
+	var paths []string
+	for path := range im.indexedFiles() {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// Test that an update only indexes new and changed files and drops removed ones
+func TestIndexManager_UpdateFiles(t *testing.T) {
+	root := makeTree(t, "same.txt", "changed.txt", "removed.txt", "touched.txt")
+	path := func(name string) string { return filepath.Join(root, name) }
+	opts := IndexOptions{ChunkSize: 16, Workers: 2, FileWorkers: 2}
+
+	files, err := ExpandInput(root, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := NewIndexManager()
+	if err := im.IndexFiles(context.Background(), files, opts); err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(t.TempDir(), "index.idx")
+	if err := im.Save(indexPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file records survive a save and load
+	loaded := NewIndexManager()
+	if err := loaded.Load(indexPath); err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	if !slices.Equal(loaded.Files(), im.Files()) || len(loaded.Files()) != 4 {
+		t.Fatalf("file records changed in the index file: %+v", loaded.Files())
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.WriteFile(path("changed.txt"), []byte("different text altogether"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path("touched.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path("removed.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("added.txt"), []byte("a new file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err = ExpandInput(root, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// chunk size and features come from the index, not from these options
+	summary, err := loaded.UpdateFiles(context.Background(), files, IndexOptions{ChunkSize: 4096, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := UpdateSummary{Added: 1, Changed: 1, Removed: 1, Unchanged: 2, Touched: 1}
+	if summary != want {
+		t.Errorf("got summary %+v, want %+v", summary, want)
+	}
+
+	if got, want := indexedPaths(loaded), []string{path("added.txt"), path("changed.txt"), path("same.txt"), path("touched.txt")}; !slices.Equal(got, want) {
+		t.Errorf("indexed files %v, want %v", got, want)
+	}
+	if entries := loaded.EntriesAt(path("changed.txt"), 16); len(entries) != 1 || entries[0].Size != 9 {
+		t.Errorf("expected the changed file chunked again at 16 bytes, got %+v", entries)
+	}
+
+	summary, err = loaded.UpdateFiles(context.Background(), files, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Modified() || summary.Unchanged != 4 {
+		t.Errorf("expected nothing to update, got %+v", summary)
+	}
+}
+
+// Test that an index without a header can't be updated
+func TestIndexManager_UpdateFilesWithoutHeader(t *testing.T) {
+	im := NewIndexManager()
+	im.Add("42", IndexEntry{OriginalFile: "a.txt", Size: 10})
+	if _, err := im.UpdateFiles(context.Background(), []string{"a.txt"}, IndexOptions{}); err == nil {
+		t.Error("Expected an error for an index without a header, but found none")
+	}
+}
@@ -0,0 +1,171 @@
+package internals
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bravian1/Textblitz/simhash"
+)
+
+// MappedIndex answers lookups straight from a memory-mapped binary index file.
+//
+// Opening one only reads the section headers and the string table, so it takes about
+// the same time for any number of records. Exact lookups binary-search the sorted
+// records; fuzzy lookups scan their hash column, which touches 8 of every 24 bytes,
+// until UseTable builds permuted tables from it (see simhash.Table). Nothing is
+// decoded until it is returned as a match.
+//
+// A MappedIndex is safe for concurrent searches. It must be closed to unmap the file.
+type MappedIndex struct {
+	bi    *binaryIndex
+	unmap func() error
+
+	// table is built from the hash column on demand, see UseTable; nil until then
+	tableOnce sync.Once
+	table     atomic.Pointer[simhash.Table]
+	scans     atomic.Int64 // fuzzy lookups that scanned the hash column
+}
+
+// tableAfterScans is the number of fuzzy lookups a MappedIndex answers by scanning its
+// hash column before it builds the permuted tables for the ones that follow. A table
+// costs several scans to build, so a single lookup is left to scan.
+const tableAfterScans = 8
+
+// OpenMapped maps a binary index file into memory
+func OpenMapped(path string) (*MappedIndex, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bi, err := parseBinaryIndex(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("failed to decode index: %w", err)
+	}
+	return &MappedIndex{bi: bi, unmap: unmap}, nil
+}
+
+// Close unmaps the index file. Matches already returned stay valid.
+func (m *MappedIndex) Close() error {
+	if m.unmap == nil {
+		return nil
+	}
+	err := m.unmap()
+	m.unmap = nil
+	m.bi = &binaryIndex{header: m.bi.header}
+	return err
+}
+
+// Header returns the header of the index file
+func (m *MappedIndex) Header() IndexHeader {
+	return m.bi.header
+}
+
+// files returns the source file records of the index
+func (m *MappedIndex) files() map[string]FileRecord {
+	return m.bi.fileMap()
+}
+
+// Len returns the number of entries in the index
+func (m *MappedIndex) Len() int {
+	return m.bi.count
+}
+
+// UseTable builds a simhash.Table over the hash column so that later fuzzy lookups use
+// the permuted tables instead of scanning every record. Building it sorts a copy of the
+// column for every block count searched, which costs more than several scans, so it
+// only pays off when many queries are searched, as in a batch. Search builds it by
+// itself once it has scanned tableAfterScans times.
+func (m *MappedIndex) UseTable() {
+	m.tableOnce.Do(func() {
+		hashes := make([]uint64, m.bi.count)
+		for i := range hashes {
+			hashes[i] = m.hashAt(i)
+		}
+		m.table.Store(simhash.NewTable(hashes))
+	})
+}
+
+// Search returns the ranked matches for queryHash, like IndexManager.Search.
+// Records that point outside the file's sections are skipped.
+func (m *MappedIndex) Search(queryHash simhash.Fingerprint, opts SearchOptions) []Match {
+	query := uint64(queryHash)
+	table := m.table.Load()
+
+	var matches []Match
+	switch {
+	case opts.Threshold < 0:
+	case opts.Threshold == 0:
+		matches = m.appendRun(matches, query, 0)
+	case table != nil:
+		for _, hash := range table.Search(query, opts.Threshold) {
+			matches = m.appendRun(matches, hash, hammingDistance(query, hash))
+		}
+	default:
+		for i := range m.bi.count {
+			hash := m.hashAt(i)
+			if distance := hammingDistance(query, hash); distance <= opts.Threshold {
+				matches = m.appendMatch(matches, i, distance)
+			}
+		}
+		if m.scans.Add(1) == tableAfterScans {
+			m.UseTable()
+		}
+	}
+
+	matches = mergeSpans(matches)
+	rankMatches(matches)
+	return pageMatches(matches, opts.Offset, opts.TopK)
+}
+
+// EntriesAt returns the entries whose chunk starts at position.
+// An empty sourceFile matches entries from any file.
+func (m *MappedIndex) EntriesAt(sourceFile string, position int) []IndexEntry {
+	var found []IndexEntry
+	for i := range m.bi.count {
+		r := m.bi.record(i)
+		if r.offset != uint64(position) {
+			continue
+		}
+		_, entry, ok := m.bi.entry(i)
+		if !ok || (sourceFile != "" && entry.OriginalFile != sourceFile) {
+			continue
+		}
+		found = append(found, entry)
+	}
+	return found
+}
+
+// indexMap decodes every record, for when the index is about to be modified
+func (m *MappedIndex) indexMap() (IndexMap, error) {
+	if err := m.bi.validate(); err != nil {
+		return nil, fmt.Errorf("failed to decode index: %w", err)
+	}
+	return m.bi.indexMap(), nil
+}
+
+// appendRun appends the matches for every record stored under hash.
+// Records are sorted by hash, so they form one run found by binary search.
+func (m *MappedIndex) appendRun(matches []Match, hash uint64, distance int) []Match {
+	i := sort.Search(m.bi.count, func(i int) bool { return m.hashAt(i) >= hash })
+	for ; i < m.bi.count && m.hashAt(i) == hash; i++ {
+		matches = m.appendMatch(matches, i, distance)
+	}
+	return matches
+}
+
+func (m *MappedIndex) appendMatch(matches []Match, i int, distance int) []Match {
+	hash, entry, ok := m.bi.entry(i)
+	if !ok {
+		return matches
+	}
+	return append(matches, Match{SimHash: simhash.Fingerprint(hash), Distance: distance, Chunks: 1, IndexEntry: entry})
+}
+
+// hashAt reads the hash of the i-th record
+func (m *MappedIndex) hashAt(i int) uint64 {
+	return binary.LittleEndian.Uint64(m.bi.records[i*recordLen:])
+}
@@ -0,0 +1,158 @@
+package internals
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/bravian1/Textblitz/simhash"
+)
+
+// Test that searching the mapped file gives the same matches as searching the decoded index
+func TestMappedIndex_SearchMatchesIndexManager(t *testing.T) {
+	im := testIndex(2000)
+	path := filepath.Join(t.TempDir(), "index.idx")
+	if err := im.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	mapped, err := OpenMapped(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+	if mapped.Len() != im.Len() {
+		t.Fatalf("expected %d entries, got %d", im.Len(), mapped.Len())
+	}
+
+	rng := rand.New(rand.NewSource(3))
+	keys := make([]string, 0, len(im.index))
+	for key := range im.index {
+		keys = append(keys, key)
+	}
+
+	check := func(name string) {
+		for i := range 200 {
+			query, _ := simhash.ParseFingerprint(keys[rng.Intn(len(keys))])
+			query ^= simhash.Fingerprint(1) << rng.Intn(64)
+			opts := SearchOptions{Threshold: i % 12, TopK: i % 4}
+
+			want := im.Search(query, opts)
+			got := mapped.Search(query, opts)
+			if len(want) == 0 && len(got) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: query %d threshold %d: got %d matches, want %d", name, query, opts.Threshold, len(got), len(want))
+			}
+		}
+	}
+
+	// a few lookups scan the hash column, and repeated ones build the tables
+	for range tableAfterScans - 1 {
+		mapped.Search(0, SearchOptions{Threshold: 1})
+	}
+	if mapped.table.Load() != nil {
+		t.Fatal("expected lookups to scan before building the tables")
+	}
+	check("scan")
+	if mapped.table.Load() == nil {
+		t.Fatal("expected repeated lookups to build the tables")
+	}
+	check("table")
+}
+
+// Test that concurrent fuzzy lookups agree while one of them builds the tables
+func TestMappedIndex_ConcurrentSearch(t *testing.T) {
+	im := testIndex(500)
+	path := filepath.Join(t.TempDir(), "index.idx")
+	if err := im.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := OpenMapped(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+
+	var query simhash.Fingerprint
+	for key := range im.index {
+		query, _ = simhash.ParseFingerprint(key)
+		break
+	}
+	want := im.Search(query, SearchOptions{Threshold: 3})
+
+	var wg sync.WaitGroup
+	for range 2 * tableAfterScans {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := mapped.Search(query, SearchOptions{Threshold: 3}); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %d matches, want %d", len(got), len(want))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Test that a mapped index can be changed and saved over the file it is mapped from
+func TestIndexManager_SaveOverMappedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.idx")
+	if err := testIndex(100).Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	im := NewIndexManager()
+	if err := im.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if im.mapped == nil {
+		t.Fatal("expected a binary index to be mapped")
+	}
+	if err := im.Add("42", IndexEntry{OriginalFile: "added.txt", Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewIndexManager()
+	if err := reloaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if reloaded.Len() != 101 {
+		t.Errorf("expected 101 entries, got %d", reloaded.Len())
+	}
+	if len(reloaded.EntriesAt("added.txt", 0)) != 1 {
+		t.Error("expected the added entry to be saved")
+	}
+}
+
+func benchmarkOpen(b *testing.B, entries int) {
+	path := filepath.Join(b.TempDir(), "index.idx")
+	var buf bytes.Buffer
+	if err := testIndex(entries).SaveBinary(&buf); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for range b.N {
+		mapped, err := OpenMapped(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		mapped.Search(simhash.Fingerprint(42), SearchOptions{})
+		mapped.Close()
+	}
+}
+
+// Opening and searching exactly should take the same time for both sizes
+func BenchmarkOpenMapped_1k(b *testing.B)   { benchmarkOpen(b, 1_000) }
+func BenchmarkOpenMapped_100k(b *testing.B) { benchmarkOpen(b, 100_000) }
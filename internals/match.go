@@ -0,0 +1,130 @@
+package internals
+
+import (
+	"sort"
+
+	"github.com/bravian1/Textblitz/simhash"
+)
+
+// Match is a single lookup result: an index entry together with the SimHash
+// it is stored under and that hash's Hamming distance from the query.
+//
+// In an index of overlapping chunks, one Match can stand for several chunks of the
+// same file; its Position and Size then span all of them, see mergeSpans.
+type Match struct {
+	SimHash  simhash.Fingerprint
+	Distance int
+	Chunks   int // number of indexed chunks this match covers
+	IndexEntry
+}
+
+// SearchOptions controls which matches a search returns
+type SearchOptions struct {
+	Threshold int // maximum Hamming distance for fuzzy lookup
+	TopK      int // return at most this many matches, 0 for all of them
+	Offset    int // skip this many matches first, for paging through results
+}
+
+// Search returns the ranked matches for queryHash.
+//
+// Candidates come from the permuted hash tables (see simhash.Table), so only keys
+// sharing a block with the query are compared. Matches are ordered by distance,
+// closest first, with ties broken by file and then position, so the order is stable
+// from run to run. Hits on overlapping chunks of the same file are merged into one
+// match first. Offset and TopK then select a page of that ranking.
+//
+// A mapped index is searched in place, see MappedIndex.Search.
+func (im *IndexManager) Search(queryHash simhash.Fingerprint, opts SearchOptions) []Match {
+	if im.mapped != nil {
+		return im.mapped.Search(queryHash, opts)
+	}
+
+	table, keys := im.searchTable()
+
+	var matches []Match
+	for _, hash := range table.Search(uint64(queryHash), opts.Threshold) {
+		distance := hammingDistance(uint64(queryHash), hash)
+		for _, entry := range im.index[keys[hash]] {
+			matches = append(matches, Match{SimHash: simhash.Fingerprint(hash), Distance: distance, Chunks: 1, IndexEntry: entry})
+		}
+	}
+
+	matches = mergeSpans(matches)
+	rankMatches(matches)
+	return pageMatches(matches, opts.Offset, opts.TopK)
+}
+
+// mergeSpans merges matches on chunks that overlap in the same file into a single match
+// spanning all of them. Chunks only overlap in indexes built with a stride (see
+// IndexOptions.Stride), where a passage is matched by every window it falls in.
+// The merged match keeps the SimHash, distance and words of its closest chunk.
+func mergeSpans(matches []Match) []Match {
+	if len(matches) < 2 {
+		return matches
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].OriginalFile != matches[j].OriginalFile {
+			return matches[i].OriginalFile < matches[j].OriginalFile
+		}
+		return matches[i].Position < matches[j].Position
+	})
+
+	merged := matches[:0]
+	for _, m := range matches {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if m.OriginalFile == last.OriginalFile && m.Position < last.Position+last.Size {
+				*last = mergeSpan(*last, m)
+				continue
+			}
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// mergeSpan merges m into span, which starts at or before it
+func mergeSpan(span, m Match) Match {
+	merged := span
+	if m.Distance < span.Distance {
+		merged = m
+	}
+	merged.Position, merged.Line, merged.Column, merged.RuneOffset = span.Position, span.Line, span.Column, span.RuneOffset
+	merged.Page, merged.Section = span.Page, span.Section
+	merged.Size = max(span.Position+span.Size, m.Position+m.Size) - span.Position
+	merged.EndLine = max(span.EndLine, m.EndLine)
+	merged.EndPage = max(span.EndPage, m.EndPage)
+	merged.Chunks = span.Chunks + m.Chunks
+	return merged
+}
+
+// rankMatches sorts matches by distance, then file, then position
+func rankMatches(matches []Match) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.OriginalFile != b.OriginalFile {
+			return a.OriginalFile < b.OriginalFile
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.SimHash < b.SimHash
+	})
+}
+
+// pageMatches skips the first offset matches and keeps at most topK of the rest (all if topK is 0)
+func pageMatches(matches []Match, offset, topK int) []Match {
+	if offset > 0 {
+		if offset >= len(matches) {
+			return nil
+		}
+		matches = matches[offset:]
+	}
+	if topK > 0 && topK < len(matches) {
+		matches = matches[:topK]
+	}
+	return matches
+}
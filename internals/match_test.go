@@ -0,0 +1,87 @@
+package internals
+
+import (
+	"testing"
+
+	"github.com/bravian1/Textblitz/simhash"
+)
+
+// Test that matches are ranked by distance, then file, then position, and paged with TopK/Offset
+func TestIndexManager_SearchRanking(t *testing.T) {
+	im := NewIndexManager()
+	query := simhash.Fingerprint(0b1111_0000)
+
+	im.Add((query ^ 0b11).String(), IndexEntry{OriginalFile: "a.txt", Position: 0})    // distance 2
+	im.Add(query.String(), IndexEntry{OriginalFile: "b.txt", Position: 4096})          // distance 0
+	im.Add(query.String(), IndexEntry{OriginalFile: "a.txt", Position: 8192})          // distance 0
+	im.Add((query ^ 0b1).String(), IndexEntry{OriginalFile: "b.txt", Position: 0})     // distance 1
+	im.Add((query ^ 0b111).String(), IndexEntry{OriginalFile: "c.txt", Position: 0})   // distance 3, outside threshold
+	im.Add((query ^ 0b10).String(), IndexEntry{OriginalFile: "a.txt", Position: 4096}) // distance 1
+
+	want := []struct {
+		file     string
+		position int
+		distance int
+	}{
+		{"a.txt", 8192, 0},
+		{"b.txt", 4096, 0},
+		{"a.txt", 4096, 1},
+		{"b.txt", 0, 1},
+		{"a.txt", 0, 2},
+	}
+
+	matches := im.Search(query, SearchOptions{Threshold: 2})
+	if len(matches) != len(want) {
+		t.Fatalf("expected %d matches, got %d", len(want), len(matches))
+	}
+	for i, m := range matches {
+		if m.OriginalFile != want[i].file || m.Position != want[i].position || m.Distance != want[i].distance {
+			t.Errorf("match %d = %s@%d (distance %d), want %s@%d (distance %d)",
+				i, m.OriginalFile, m.Position, m.Distance, want[i].file, want[i].position, want[i].distance)
+		}
+	}
+
+	page := im.Search(query, SearchOptions{Threshold: 2, TopK: 2, Offset: 2})
+	if len(page) != 2 || page[0].Position != 4096 || page[1].OriginalFile != "b.txt" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	if past := im.Search(query, SearchOptions{Threshold: 2, Offset: 10}); len(past) != 0 {
+		t.Errorf("expected no matches past the end, got %d", len(past))
+	}
+}
+
+// Test that hits on overlapping chunks of the same file merge into one span
+func TestIndexManager_SearchMergesOverlaps(t *testing.T) {
+	im := NewIndexManager()
+	query := simhash.Fingerprint(0b1111_0000)
+
+	// 100 byte windows every 50 bytes
+	im.Add((query ^ 0b1).String(), IndexEntry{OriginalFile: "a.txt", Position: 0, Size: 100, Line: 1, EndLine: 3})    // distance 1
+	im.Add(query.String(), IndexEntry{OriginalFile: "a.txt", Position: 50, Size: 100, Line: 2, EndLine: 4})           // distance 0
+	im.Add((query ^ 0b11).String(), IndexEntry{OriginalFile: "a.txt", Position: 100, Size: 100, Line: 3, EndLine: 5}) // distance 2
+	im.Add(query.String(), IndexEntry{OriginalFile: "a.txt", Position: 300, Size: 100})                               // not overlapping
+	im.Add((query ^ 0b1).String(), IndexEntry{OriginalFile: "b.txt", Position: 50, Size: 100})                        // another file
+
+	matches := im.Search(query, SearchOptions{Threshold: 2})
+	if len(matches) != 3 {
+		t.Fatalf("expected 3 matches, got %d: %+v", len(matches), matches)
+	}
+
+	span := matches[0]
+	if span.OriginalFile != "a.txt" || span.Position != 0 || span.Size != 200 || span.Chunks != 3 {
+		t.Errorf("unexpected merged span %s@%d+%d (%d chunks)", span.OriginalFile, span.Position, span.Size, span.Chunks)
+	}
+	if span.Line != 1 || span.EndLine != 5 {
+		t.Errorf("expected the merged span to cover lines 1-5, got %d-%d", span.Line, span.EndLine)
+	}
+	if span.Distance != 0 || span.SimHash != query {
+		t.Errorf("expected the merged span to keep its closest chunk, got distance %d", span.Distance)
+	}
+	if single := matches[1]; single.Position != 300 || single.Chunks != 1 {
+		t.Errorf("unexpected match %+v", single)
+	}
+	if other := matches[2]; other.OriginalFile != "b.txt" || other.Size != 100 {
+		t.Errorf("unexpected match %+v", other)
+	}
+}
@@ -0,0 +1,118 @@
+package internals
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MergeSummary counts what MergeIndexes did
+type MergeSummary struct {
+	Indexes    int // indexes merged
+	Entries    int // entries in the merged index
+	Duplicates int // entries left out because an identical one was already merged
+}
+
+// MergeIndexes loads every index file and merges them into one index, see Merge.
+// Errors name the index file they come from.
+func MergeIndexes(paths []string) (*IndexManager, MergeSummary, error) {
+	var summary MergeSummary
+	merged := NewIndexManager()
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		other := NewIndexManager()
+		if err := other.Load(path); err != nil {
+			return nil, summary, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		duplicates, err := merged.merge(other, seen)
+		other.Close()
+		if err != nil {
+			return nil, summary, fmt.Errorf("failed to merge %s: %w", path, err)
+		}
+		summary.Indexes++
+		summary.Duplicates += duplicates
+	}
+	summary.Entries = merged.Len()
+	return merged, summary, nil
+}
+
+// Merge adds the entries and source file records of other to the index, and returns
+// how many of its entries were left out because the index already has an identical one.
+//
+// Both indexes must have been chunked and hashed the same way (see
+// IndexHeader.CheckCompatible); an empty index takes the header of other. Neither may
+// hold chunks of documents extracted by an older version (see IndexHeader.CheckSource).
+// If both record the same source file, the record with the later modification time is kept.
+func (im *IndexManager) Merge(other *IndexManager) (int, error) {
+	return im.merge(other, nil)
+}
+
+// merge is Merge with the keys of the entries already in the index, see entryKey.
+// seen is filled in on the first call if it is empty, and kept up to date, so merging
+// several indexes doesn't collect the keys again for each one.
+func (im *IndexManager) merge(other *IndexManager, seen map[string]bool) (int, error) {
+	if !other.header.Known() {
+		return 0, fmt.Errorf("the index has no header recording how it was built; rebuild it before merging it")
+	}
+	if err := im.materialize(); err != nil {
+		return 0, err
+	}
+	if err := other.materialize(); err != nil {
+		return 0, err
+	}
+	if err := other.checkSources(); err != nil {
+		return 0, err
+	}
+
+	empty := im.Len() == 0 && len(im.files) == 0 && !im.header.Known()
+	if empty {
+		im.header = other.header
+	} else if err := im.header.CheckCompatible(other.header); err != nil {
+		return 0, err
+	} else if err := im.checkSources(); err != nil {
+		return 0, err
+	}
+	// neither index has documents extracted the old way
+	im.header.Extractor = ExtractorVersion
+
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+	if len(seen) == 0 {
+		for key, entries := range im.index {
+			for _, entry := range entries {
+				seen[entryKey(key, entry)] = true
+			}
+		}
+	}
+
+	duplicates := 0
+	for key, entries := range other.index {
+		for _, entry := range entries {
+			k := entryKey(key, entry)
+			if seen[k] {
+				duplicates++
+				continue
+			}
+			seen[k] = true
+			im.index[key] = append(im.index[key], entry)
+		}
+	}
+	for _, record := range other.files {
+		if existing, ok := im.files[record.Path]; ok && existing.ModTime >= record.ModTime {
+			continue
+		}
+		im.setFile(record)
+	}
+	im.invalidate()
+	return duplicates, nil
+}
+
+// entryKey identifies an entry by its SimHash and every field, so two entries
+// have the same key only if they are exact duplicates
+func entryKey(simhash string, entry IndexEntry) string {
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%d\x00%d\x00%d\x00%d\x00%d\x00%d\x00%s\x00%d\x00%s\x00%s", simhash,
+		entry.OriginalFile, entry.Size, entry.Position,
+		entry.Line, entry.EndLine, entry.Column, entry.RuneOffset,
+		entry.Page, entry.EndPage, entry.Section, entry.Record, entry.Key,
+		strings.Join(entry.AssociatedWords, "\x00"))
+}
@@ -0,0 +1,100 @@
+package internals
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Test that merging indexes unions their entries and file records, without duplicates
+func TestMergeIndexes(t *testing.T) {
+	root := makeTree(t, "sales/a.txt", "sales/b.txt", "support/c.txt")
+	opts := IndexOptions{ChunkSize: 8, Workers: 2}
+	dir := t.TempDir()
+
+	// the two indexes share b.txt, whose entries must only be merged once
+	build := func(name string, files ...string) (string, *IndexManager) {
+		im := NewIndexManager()
+		paths := make([]string, len(files))
+		for i, file := range files {
+			paths[i] = filepath.Join(root, file)
+		}
+		if err := im.IndexFiles(context.Background(), paths, opts); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := im.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		return path, im
+	}
+	salesPath, sales := build("sales.idx", "sales/a.txt", "sales/b.txt")
+	supportPath, support := build("support.idx", "sales/b.txt", "support/c.txt")
+	_, shared := build("shared.idx", "sales/b.txt")
+
+	merged, summary, err := MergeIndexes([]string{salesPath, supportPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Indexes != 2 || summary.Duplicates != shared.Len() {
+		t.Errorf("Expected 2 indexes and %d duplicates, got %+v", shared.Len(), summary)
+	}
+	if want := sales.Len() + support.Len() - shared.Len(); merged.Len() != want || summary.Entries != want {
+		t.Errorf("Expected %d entries, got %d (summary %d)", want, merged.Len(), summary.Entries)
+	}
+	for _, file := range []string{"sales/a.txt", "sales/b.txt", "support/c.txt"} {
+		if !slices.Contains(indexedPaths(merged), filepath.Join(root, file)) {
+			t.Errorf("Merged index has no entries of %s", file)
+		}
+	}
+	if len(merged.Files()) != 3 {
+		t.Errorf("Expected 3 file records, got %+v", merged.Files())
+	}
+	if merged.Header().ChunkSize != 8 {
+		t.Errorf("Expected the merged index to keep chunk size 8, got %d", merged.Header().ChunkSize)
+	}
+
+	// merging an index into itself adds nothing
+	duplicates, err := merged.Merge(sales)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duplicates != sales.Len() || merged.Len() != summary.Entries {
+		t.Errorf("Expected every entry to be a duplicate, got %d duplicates and %d entries", duplicates, merged.Len())
+	}
+}
+
+// Test that indexes chunked or hashed differently are not merged
+func TestMergeIndexes_Incompatible(t *testing.T) {
+	root := makeTree(t, "a.txt")
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name string
+		opts IndexOptions
+		want string
+	}{
+		{"chunk size", IndexOptions{ChunkSize: 16}, "chunk size"},
+		{"split", IndexOptions{ChunkSize: 8, Split: "word"}, "split word"},
+		{"features", IndexOptions{ChunkSize: 8, Features: FeatureOptions{FeatureSet: "ngram"}}, "features"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			paths := make([]string, 2)
+			for i, opts := range []IndexOptions{{ChunkSize: 8}, tc.opts} {
+				im := NewIndexManager()
+				if err := im.IndexFile(context.Background(), filepath.Join(root, "a.txt"), opts); err != nil {
+					t.Fatal(err)
+				}
+				paths[i] = filepath.Join(dir, tc.name+string(rune('a'+i))+".idx")
+				if err := im.Save(paths[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, _, err := MergeIndexes(paths)
+			if err == nil || !strings.Contains(err.Error(), tc.want) || !strings.Contains(err.Error(), paths[1]) {
+				t.Errorf("Expected an error about %s naming %s, got %v", tc.want, paths[1], err)
+			}
+		})
+	}
+}
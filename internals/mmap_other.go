@@ -0,0 +1,17 @@
+//go:build !unix
+
+package internals
+
+import (
+	"fmt"
+	"os"
+)
+
+// mapFile reads the whole file into memory on platforms without mmap support
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read index file: %w", err)
+	}
+	return data, func() error { return nil }, nil
+}
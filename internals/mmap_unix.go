@@ -0,0 +1,37 @@
+//go:build unix
+
+package internals
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile maps a whole file read-only into memory. The returned function unmaps it;
+// the data must not be used after that.
+func mapFile(path string) ([]byte, func() error, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open index file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat index file: %w", err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, func() error { return nil }, nil
+	}
+	if int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("index file is too large to map: %d bytes", size)
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to map index file: %w", err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -1,20 +1,45 @@
 package internals
 
 import (
+	"bufio"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"path/filepath"
+	"sync"
+
+	"github.com/bravian1/Textblitz/simhash"
 )
 
 // IndexEntry represents a record in the index, linking a SimHash to its metadata.
 //
 // It provides details about where the content originated, associated words for context,
+//
+// Line, EndLine, Column and RuneOffset locate the chunk the way editors do (see
+// indexer.Location); they are 0 in indexes written before they were recorded.
+//
+// Page, EndPage and Section locate a chunk of a PDF or DOCX document the way its readers
+// do. Position and Size are offsets into the text extracted from such a document, which
+// mean nothing in the document itself; Page is 0 for other files, and for documents that
+// don't say where their pages start.
+//
+// Record and Key identify a chunk that is a record of a CSV, TSV or JSON lines file (see
+// IndexOptions.Split): its number, from 1, and the value of its key column or field.
 type IndexEntry struct {
 	OriginalFile    string
 	Size            int
 	Position        int
+	Line            int
+	EndLine         int
+	Column          int
+	RuneOffset      int
+	Page            int
+	EndPage         int
+	Section         string
+	Record          int
+	Key             string
 	AssociatedWords []string
 }
 
@@ -22,7 +47,24 @@ type IndexMap map[string][]IndexEntry
 
 // IndexManager handles all operations related to the index
 type IndexManager struct {
-	index IndexMap
+	index  IndexMap
+	header IndexHeader
+
+	// files records the source files the index was built from, see UpdateFiles
+	files map[string]FileRecord
+
+	// mapped is set while the index is read straight from a mapped binary file.
+	// It is decoded into index before the index is modified or saved, see materialize
+	mapped *MappedIndex
+
+	// hashFormat is how SimHash keys are written in the JSON copy of the index
+	hashFormat simhash.Format
+
+	// table answers fuzzy lookups over the index keys. It is built on the
+	// first lookup after the index changes, see searchTable
+	mu    sync.Mutex
+	table *simhash.Table
+	keys  map[uint64]string
 }
 
 // NewIndexManager creates a new index manager
@@ -32,7 +74,11 @@ func NewIndexManager() *IndexManager {
 	}
 }
 
-// Load reads an index from disk using gob encoding
+// Load reads an index from disk.
+//
+// Files in the binary format (see binindex.go) are recognised by their magic bytes and
+// memory-mapped rather than decoded, see MappedIndex; call Close when done with them.
+// Anything else is read as a gob index, see LoadGob.
 func (im *IndexManager) Load(inputFile string) error {
 	file, err := os.Open(inputFile)
 	if err != nil {
@@ -40,96 +86,359 @@ func (im *IndexManager) Load(inputFile string) error {
 	}
 	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
-	if err := decoder.Decode(&im.index); err != nil {
+	prefix := make([]byte, len(binaryMagic))
+	n, err := io.ReadFull(file, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("failed to read index file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read index file: %w", err)
+	}
+
+	if isBinaryIndex(prefix[:n]) {
+		mapped, err := OpenMapped(inputFile)
+		if err != nil {
+			return err
+		}
+		im.Close()
+		im.index = make(IndexMap)
+		im.header = mapped.Header()
+		im.files = mapped.files()
+		im.mapped = mapped
+		im.invalidate()
+		return nil
+	}
+	return im.LoadGob(file)
+}
+
+// Close releases the mapped index file, if the index was loaded from one
+func (im *IndexManager) Close() error {
+	if im.mapped == nil {
+		return nil
+	}
+	err := im.mapped.Close()
+	im.mapped = nil
+	return err
+}
+
+// materialize decodes a mapped index into memory and unmaps the file,
+// so the index can be modified or written back over the same path
+func (im *IndexManager) materialize() error {
+	if im.mapped == nil {
+		return nil
+	}
+	index, err := im.mapped.indexMap()
+	if err != nil {
+		return err
+	}
+	im.index = index
+	im.invalidate()
+	return im.Close()
+}
+
+// Len returns the number of entries in the index
+func (im *IndexManager) Len() int {
+	if im.mapped != nil {
+		return im.mapped.Len()
+	}
+	n := 0
+	for _, entries := range im.index {
+		n += len(entries)
+	}
+	return n
+}
+
+// LoadBinary reads an index in the binary format
+func (im *IndexManager) LoadBinary(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read index file: %w", err)
+	}
+	bi, err := parseBinaryIndex(data)
+	if err == nil {
+		err = bi.validate()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode index: %w", err)
+	}
+
+	im.Close()
+	im.index = bi.indexMap()
+	im.header = bi.header
+	im.files = bi.fileMap()
+	im.invalidate()
+	return nil
+}
+
+// LoadGob reads an index written by SaveGob or by versions before the binary format.
+//
+// The stream holds an IndexHeader followed by the IndexMap. Files written before
+// the header existed hold only the IndexMap; those load with an empty header.
+func (im *IndexManager) LoadGob(r io.ReadSeeker) error {
+	var header IndexHeader
+	decoder := gob.NewDecoder(r)
+	if err := decoder.Decode(&header); err != nil {
+		// no header, so this is a version 1 index: decode it again as a bare map
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read index file: %w", err)
+		}
+		header = IndexHeader{}
+		decoder = gob.NewDecoder(r)
+	} else if err := header.checkVersion(); err != nil {
+		return err
+	}
+
+	index := make(IndexMap)
+	if err := decoder.Decode(&index); err != nil {
 		return fmt.Errorf("failed to decode index: %v", err)
 	}
+	im.Close()
+	im.index = index
+	im.header = header
+	im.files = nil
+	im.invalidate()
 	return nil
 }
 
+// Header returns the header describing how the index was built
+func (im *IndexManager) Header() IndexHeader {
+	return im.header
+}
+
+// SetHeader replaces the index header
+func (im *IndexManager) SetHeader(header IndexHeader) {
+	im.header = header
+}
+
+// HashText computes the SimHash of text with the feature set the index was built with,
+// so it can be compared with the indexed chunks
+func (im *IndexManager) HashText(text string) simhash.Fingerprint {
+	return im.header.Features().Hash(text)
+}
+
 // Lookup searches for entries with the given simhash value
 //
 // Add adds a new entry to the index
 func (im *IndexManager) Add(simhash string, entry IndexEntry) error {
+	if err := im.materialize(); err != nil {
+		return err
+	}
 	im.index[simhash] = append(im.index[simhash], entry)
+	im.invalidate()
 	return nil
 }
 
-// Save writes the index to disk in both binary (gob) and JSON formats
+// SetHashFormat sets how SimHash keys are written in the JSON copy of the index.
+// The binary index always stores them the same way.
+func (im *IndexManager) SetHashFormat(format simhash.Format) {
+	im.hashFormat = format
+}
+
+// formattedIndex returns the index with its keys rewritten in the configured hash format
+func (im *IndexManager) formattedIndex() IndexMap {
+	if im.hashFormat == simhash.Decimal {
+		return im.index
+	}
+
+	formatted := make(IndexMap, len(im.index))
+	for key, entries := range im.index {
+		hash, err := simhash.ParseFingerprint(key)
+		if err != nil {
+			formatted[key] = entries
+			continue
+		}
+		formatted[hash.Format(im.hashFormat)] = entries
+	}
+	return formatted
+}
+
+// Save writes the index to disk in the binary format, plus a JSON copy for reading.
+//
+// Both files are written next to their final path and renamed over it once complete,
+// so a save that fails or is interrupted leaves the previous index in place. If only
+// the JSON copy can't be written, the index is saved and the error is a *JSONCopyError.
 func (im *IndexManager) Save(outputFile string) error {
-	// Save in binary gob format for efficient loading
-	file, err := os.Create(outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create index file: %w", err)
+	// the file may be the one the index is mapped from, so decode it before replacing it
+	if err := im.materialize(); err != nil {
+		return err
 	}
-	defer file.Close()
 
-	encoder := gob.NewEncoder(file)
-	if err := encoder.Encode(im.index); err != nil {
-		return fmt.Errorf("failed to encode index: %w", err)
+	err := writeAtomic(outputFile, func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		if err := im.SaveBinary(bw); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("failed to write index file: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	// Also save as JSON for human readability
 	jsonFilePath := outputFile + ".json"
-	jsonFile, err := os.Create(jsonFilePath)
+	readable := struct {
+		Header IndexHeader
+		Files  []FileRecord
+		Index  IndexMap
+	}{im.savedHeader(IndexFormatVersion), im.Files(), im.formattedIndex()}
+	err = writeAtomic(jsonFilePath, func(w io.Writer) error {
+		jsonEncoder := json.NewEncoder(w)
+		jsonEncoder.SetIndent("", "  ")
+		return jsonEncoder.Encode(readable)
+	})
 	if err != nil {
-		fmt.Printf("Warning: Could not create JSON index file: %v\n", err)
-		return nil
+		return &JSONCopyError{Path: jsonFilePath, Err: err}
+	}
+	return nil
+}
+
+// JSONCopyError reports that an index was saved but its JSON copy was not
+type JSONCopyError struct {
+	Path string // where the JSON copy was to be written
+	Err  error
+}
+
+func (e *JSONCopyError) Error() string {
+	return fmt.Sprintf("could not write JSON index %s: %v", e.Path, e.Err)
+}
+
+func (e *JSONCopyError) Unwrap() error {
+	return e.Err
+}
+
+// writeAtomic writes a file with write into a temporary file in the same directory,
+// then renames it over path. An existing file keeps its permissions.
+func writeAtomic(path string, write func(w io.Writer) error) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
 	}
-	defer jsonFile.Close()
 
-	jsonEncoder := json.NewEncoder(jsonFile)
-	jsonEncoder.SetIndent("", "  ")
-	if err := jsonEncoder.Encode(im.index); err != nil {
-		fmt.Printf("Warning: Could not encode JSON index: %v\n", err)
-	} else {
-		fmt.Printf("Created human-readable index: %s\n", jsonFilePath)
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create index file: %w", err)
 	}
+	// removes the temporary file if anything below fails; after the rename there is nothing left to remove
+	defer os.Remove(tmp.Name())
 
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write index file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write index file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to write index file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace index file: %w", err)
+	}
 	return nil
 }
 
-// LookUp performs a fuzzy search for similar hashes within a specified threshold.
-//
-// It follows these steps:
-//
-// 1. Load the precomputed index from a file.
-//
-// 2. Parse the input SimHash and compare it against stored hashes using Hamming Distance.
-//
-// 3. Return matches if the Hamming Distance is within the given threshold.
-func (im *IndexManager) LookUp(input_file string, simHash string, threshold int) error {
-	err := im.Load(input_file)
-	if err != nil {
-		return fmt.Errorf("Error loading index: %v\n", err)
+// SaveBinary writes the index in the binary format
+func (im *IndexManager) SaveBinary(w io.Writer) error {
+	if err := im.materialize(); err != nil {
+		return err
 	}
+	if err := writeBinaryIndex(w, im.savedHeader(IndexFormatVersion), im.index, im.Files()); err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	return nil
+}
 
-	fmt.Printf("Parsing simHash: %s\n", simHash)
+// SaveGob writes the index as a gob-encoded header and IndexMap, the format used
+// before the binary format. Indexes written this way can be read by older versions.
+// The gob format has no room for the source file records, so they are not saved.
+func (im *IndexManager) SaveGob(w io.Writer) error {
+	if err := im.materialize(); err != nil {
+		return err
+	}
+	encoder := gob.NewEncoder(w)
+	if err := encoder.Encode(im.savedHeader(gobFormatVersion)); err != nil {
+		return fmt.Errorf("failed to encode index header: %w", err)
+	}
+	if err := encoder.Encode(im.index); err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	return nil
+}
 
-	queryHash, err := strconv.ParseUint(simHash, 10, 64)
-	if err != nil {
-		return fmt.Errorf("Invalid simHash format: %v", err)
+// savedHeader returns the header to write: it always records the layout and tool that wrote the file
+func (im *IndexManager) savedHeader(formatVersion int) IndexHeader {
+	header := im.header
+	header.FormatVersion = formatVersion
+	header.ToolVersion = ToolVersion
+	if header.HashFunction == "" {
+		header.HashFunction = HashFunction
 	}
+	return header
+}
 
-	fmt.Printf("Parsed queryHash: %d\n", queryHash)
+// searchTable parses the index keys once and builds the lookup table over them.
+// Keys are parsed with simhash.ParseFingerprint; keys that aren't valid SimHash values are skipped.
+//
+// Searches may run concurrently once the index is loaded, so the table is built under a lock.
+func (im *IndexManager) searchTable() (*simhash.Table, map[uint64]string) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
 
-	var matchedEntries []IndexEntry
+	if im.table != nil {
+		return im.table, im.keys
+	}
 
-	for key, entries := range im.index {
-		candidateHash, err := strconv.ParseUint(key, 10, 64)
+	im.keys = make(map[uint64]string, len(im.index))
+	hashes := make([]uint64, 0, len(im.index))
+	for key := range im.index {
+		hash, err := simhash.ParseFingerprint(key)
 		if err != nil {
 			continue
 		}
-		if hammingDistance(queryHash, candidateHash) <= threshold {
-			matchedEntries = append(matchedEntries, entries...)
-		}
-	}
-	if len(matchedEntries) == 0 {
-		return fmt.Errorf("No fuzzy matches found for SimHash: %s with threshold %d\n", simHash, threshold)
+		im.keys[uint64(hash)] = key
+		hashes = append(hashes, uint64(hash))
 	}
+	im.table = simhash.NewTable(hashes)
+	return im.table, im.keys
+}
 
-	LookUpOutput(simHash, matchedEntries)
-	return nil
+// invalidate drops the lookup table after the index changes, so the next search rebuilds it
+func (im *IndexManager) invalidate() {
+	im.mu.Lock()
+	im.table = nil
+	im.mu.Unlock()
+}
+
+// EntriesAt returns the entries whose chunk starts at position.
+// An empty sourceFile matches entries from any file.
+func (im *IndexManager) EntriesAt(sourceFile string, position int) []IndexEntry {
+	if im.mapped != nil {
+		return im.mapped.EntriesAt(sourceFile, position)
+	}
+	var found []IndexEntry
+	for _, entries := range im.index {
+		for _, entry := range entries {
+			if entry.Position != position {
+				continue
+			}
+			if sourceFile != "" && entry.OriginalFile != sourceFile {
+				continue
+			}
+			found = append(found, entry)
+		}
+	}
+	return found
 }
 
 // hammingDistance calculates the number of differing bits between two 64-bit hashes.
@@ -146,24 +455,3 @@ func hammingDistance(a, b uint64) int {
 	}
 	return count
 }
-
-// LookUpOutput formats and prints the lookup results
-func LookUpOutput(simHash string, entries []IndexEntry) {
-	if len(entries) == 0 {
-		fmt.Println("No entries found.")
-		return
-	}
-
-	fmt.Println("\nLookup Complete!")
-	fmt.Println("------------------------------------")
-
-	for _, entry := range entries {
-		fmt.Printf("| SimHash       : %s\n", simHash)
-		fmt.Printf("| Original File : %s\n", entry.OriginalFile)
-		fmt.Printf("| Position      : Byte %d\n", entry.Position)
-		fmt.Printf("| Associated Words : \"%s\"\n", entry.AssociatedWords)
-		fmt.Println("------------------------------------------------")
-	}
-
-	fmt.Println()
-}
@@ -1,6 +1,12 @@
 package internals
 
-import "testing"
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/bravian1/Textblitz/simhash"
+)
 
 func Test_hammingDistance(t *testing.T) {
 	type args struct {
@@ -37,3 +43,35 @@ func Test_hammingDistance(t *testing.T) {
 		})
 	}
 }
+
+// Test that table-backed matching returns exactly what a full scan of the index does
+func TestIndexManager_MatchMatchesScan(t *testing.T) {
+	im := NewIndexManager()
+	rng := rand.New(rand.NewSource(1))
+	hashes := make([]uint64, 2000)
+	for i := range hashes {
+		hashes[i] = rng.Uint64()
+		if i%4 == 1 {
+			hashes[i] = hashes[i-1] ^ (1 << rng.Intn(64)) ^ (1 << rng.Intn(64))
+		}
+		im.Add(strconv.FormatUint(hashes[i], 10), IndexEntry{OriginalFile: "a.txt", Position: i * 10})
+	}
+
+	for _, threshold := range []int{0, 1, 3, 8} {
+		for q := 0; q < 20; q++ {
+			query := hashes[rng.Intn(len(hashes))] ^ (1 << rng.Intn(64))
+
+			want := 0
+			for key, entries := range im.index {
+				hash, _ := strconv.ParseUint(key, 10, 64)
+				if hammingDistance(query, hash) <= threshold {
+					want += len(entries)
+				}
+			}
+
+			if got := len(im.Search(simhash.Fingerprint(query), SearchOptions{Threshold: threshold})); got != want {
+				t.Errorf("threshold %d: Search() found %d entries, scan found %d", threshold, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package internals
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	idx "github.com/bravian1/Textblitz/internals/indexer"
+	"github.com/bravian1/Textblitz/simhash"
+)
+
+// LookUpOutput formats and prints the lookup results, with SimHash values in the given format
+func LookUpOutput(matches []Match, format simhash.Format) {
+	if len(matches) == 0 {
+		fmt.Println("No entries found.")
+		return
+	}
+
+	fmt.Println("\nLookup Complete!")
+	fmt.Println("------------------------------------")
+
+	for _, entry := range matches {
+		fmt.Printf("| SimHash       : %s\n", entry.SimHash.Format(format))
+		fmt.Printf("| Distance      : %d\n", entry.Distance)
+		fmt.Printf("| Original File : %s\n", entry.OriginalFile)
+		fmt.Printf("| Position      : Byte %d\n", entry.Position)
+		printLines(entry.IndexEntry)
+		printSpan(entry)
+		fmt.Printf("| Associated Words : \"%s\"\n", entry.AssociatedWords)
+		fmt.Println("------------------------------------------------")
+	}
+
+	fmt.Println()
+}
+
+// LookUpOutputWithText prints the lookup results along with the text of each
+// matched chunk, read back from the source file with context bytes around it.
+// header is the header of the index, which says how the source files were read.
+func LookUpOutputWithText(matches []Match, context int, format simhash.Format, header IndexHeader) {
+	if len(matches) == 0 {
+		fmt.Println("No entries found.")
+		return
+	}
+
+	fmt.Println("\nLookup Complete!")
+	fmt.Println("------------------------------------")
+
+	reader := idx.NewChunkReader()
+	reader.SetReadOptions(header.ReadOptions())
+	for _, entry := range matches {
+		fmt.Printf("| SimHash       : %s\n", entry.SimHash.Format(format))
+		fmt.Printf("| Distance      : %d\n", entry.Distance)
+		fmt.Printf("| Original File : %s\n", entry.OriginalFile)
+		fmt.Printf("| Position      : Byte %d\n", entry.Position)
+		printLines(entry.IndexEntry)
+		printSpan(entry)
+		fmt.Printf("| Associated Words : \"%s\"\n", entry.AssociatedWords)
+
+		excerpt, err := readChunk(reader, header, entry.IndexEntry, context)
+		if err != nil {
+			fmt.Printf("| Text          : unavailable (%v)\n", err)
+		} else {
+			fmt.Println("| Text          :")
+			printExcerpt(excerpt)
+		}
+		fmt.Println("------------------------------------------------")
+	}
+
+	fmt.Println()
+}
+
+// ShowOutput prints the text of each entry's chunk, read back from its source
+// file with context bytes around it. header is the header of the index, which says
+// how the source files were read.
+func ShowOutput(entries []IndexEntry, context int, header IndexHeader) error {
+	reader := idx.NewChunkReader()
+	reader.SetReadOptions(header.ReadOptions())
+	for _, entry := range entries {
+		excerpt, err := readChunk(reader, header, entry, context)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("| Original File : %s\n", entry.OriginalFile)
+		fmt.Printf("| Position      : Byte %d (%d bytes)\n", entry.Position, entry.Size)
+		printLines(entry)
+		fmt.Println("------------------------------------------------")
+		printExcerpt(excerpt)
+		fmt.Println("------------------------------------------------")
+	}
+	return nil
+}
+
+// readChunk reads the chunk of entry back from its source file, if the index was built
+// from text that can still be read back (see IndexHeader.CheckSource)
+func readChunk(reader *idx.ChunkReader, header IndexHeader, entry IndexEntry, context int) (idx.Excerpt, error) {
+	if err := header.CheckSource(entry.OriginalFile); err != nil {
+		return idx.Excerpt{}, err
+	}
+	return reader.Read(entry.OriginalFile, entry.Position, entry.Size, context)
+}
+
+// LookUpJSON prints the ranked matches as a JSON array.
+// An empty result prints [] so the output always parses.
+//
+// In decimal format SimHash values are JSON numbers; in hex and binary they are strings.
+func LookUpJSON(matches []Match, format simhash.Format) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(formatMatches(matches, format)); err != nil {
+		return fmt.Errorf("failed to encode matches: %w", err)
+	}
+	return nil
+}
+
+// jsonMatch is a Match as printed by LookUpJSON
+type jsonMatch struct {
+	SimHash  jsonFingerprint
+	Distance int
+	Chunks   int
+	IndexEntry
+}
+
+// formatMatches converts matches to their JSON form. It never returns nil, so no matches encode as []
+func formatMatches(matches []Match, format simhash.Format) []jsonMatch {
+	formatted := make([]jsonMatch, len(matches))
+	for i, m := range matches {
+		formatted[i] = jsonMatch{SimHash: jsonFingerprint{m.SimHash, format}, Distance: m.Distance, Chunks: m.Chunks, IndexEntry: m.IndexEntry}
+	}
+	return formatted
+}
+
+// jsonFingerprint marshals a SimHash in the requested format
+type jsonFingerprint struct {
+	hash   simhash.Fingerprint
+	format simhash.Format
+}
+
+func (f jsonFingerprint) MarshalJSON() ([]byte, error) {
+	if f.format == simhash.Decimal {
+		return []byte(f.hash.String()), nil
+	}
+	return json.Marshal(f.hash.Format(f.format))
+}
+
+// LookUpLinks prints one line per match that starts with path:line:col, which terminals
+// and editors turn into a link to the start of the chunk. Entries from indexes without
+// line numbers are printed as path:1:1 with their byte position.
+func LookUpLinks(matches []Match, format simhash.Format) {
+	for _, m := range matches {
+		place := placeOf(m.IndexEntry)
+		if place != "" {
+			place += ", "
+		}
+		if m.Line == 0 {
+			fmt.Printf("%s:1:1: %sbyte %d, distance %d, simhash %s\n", m.OriginalFile, place, m.Position, m.Distance, m.SimHash.Format(format))
+			continue
+		}
+		fmt.Printf("%s:%d:%d: %slines %d-%d, distance %d, simhash %s\n",
+			m.OriginalFile, m.Line, m.Column, place, m.Line, m.EndLine, m.Distance, m.SimHash.Format(format))
+	}
+}
+
+// printLines prints the lines a chunk covers, for indexes that record them, and the
+// pages and section of a chunk of a document or the number and key of a record
+func printLines(entry IndexEntry) {
+	if entry.Line > 0 {
+		fmt.Printf("| Lines         : %d-%d (column %d, character %d)\n", entry.Line, entry.EndLine, entry.Column, entry.RuneOffset)
+	}
+	if place := placeOf(entry); place != "" {
+		fmt.Printf("| Place         : %s\n", place)
+	}
+}
+
+// placeOf describes where a chunk of a document is the way its readers would look for
+// it, as in "page 37, section 4.2 Results" or "pages 3-4", and which record a chunk is,
+// as in "record 12, key A-1077". It is "" for chunks of text files and of documents that
+// don't record their pages or sections.
+func placeOf(entry IndexEntry) string {
+	var parts []string
+	if entry.Record > 0 {
+		parts = append(parts, fmt.Sprintf("record %d", entry.Record))
+	}
+	if entry.Key != "" {
+		parts = append(parts, "key "+entry.Key)
+	}
+	switch {
+	case entry.Page > 0 && entry.EndPage > entry.Page:
+		parts = append(parts, fmt.Sprintf("pages %d-%d", entry.Page, entry.EndPage))
+	case entry.Page > 0:
+		parts = append(parts, fmt.Sprintf("page %d", entry.Page))
+	}
+	if entry.Section != "" {
+		parts = append(parts, "section "+entry.Section)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printSpan prints the bytes covered by a match that merges several overlapping chunks
+func printSpan(match Match) {
+	if match.Chunks > 1 {
+		fmt.Printf("| Span          : Bytes %d-%d (%d overlapping chunks)\n", match.Position, match.Position+match.Size, match.Chunks)
+	}
+}
+
+// printExcerpt prints a chunk with its surrounding context. The chunk is fenced
+// with >>> and <<< markers when there is context, so it's clear where it starts and ends
+func printExcerpt(excerpt idx.Excerpt) {
+	if len(excerpt.Before) == 0 && len(excerpt.After) == 0 {
+		fmt.Println(string(excerpt.Text))
+		return
+	}
+	fmt.Printf("%s>>>%s<<<%s\n", excerpt.Before, excerpt.Text, excerpt.After)
+}
@@ -0,0 +1,30 @@
+package internals
+
+import (
+	"fmt"
+	"strings"
+
+	idx "github.com/bravian1/Textblitz/internals/indexer"
+)
+
+// ReadQuery returns the text to hash for a query.
+//
+// The text passed with -q wins; otherwise the query is read from the file given
+// with -f, where "-" means stdin.
+func ReadQuery(text string, file string) (string, error) {
+	if text != "" {
+		return text, nil
+	}
+	if file == "" {
+		return "", fmt.Errorf("no query text given (use -q <text> or -f <file>)")
+	}
+
+	data, err := idx.ReadText(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read query: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("query is empty")
+	}
+	return string(data), nil
+}
@@ -0,0 +1,25 @@
+package internals
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadQuery(t *testing.T) {
+	if got, err := ReadQuery("inline text", ""); err != nil || got != "inline text" {
+		t.Errorf("ReadQuery(text) = %q, %v", got, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "query.txt")
+	if err := os.WriteFile(path, []byte("from a file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadQuery("", path); err != nil || got != "from a file" {
+		t.Errorf("ReadQuery(file) = %q, %v", got, err)
+	}
+
+	if _, err := ReadQuery("", ""); err == nil {
+		t.Error("expected an error when no query is given")
+	}
+}
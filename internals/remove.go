@@ -0,0 +1,58 @@
+package internals
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+)
+
+// RemoveSummary lists what RemoveFiles dropped
+type RemoveSummary struct {
+	Files   []string // source files whose entries were dropped, sorted
+	Entries int      // entries dropped
+}
+
+// RemoveFiles drops every entry whose source file matches pattern, along with the
+// records of those files. Hash buckets left without entries are dropped too.
+//
+// A pattern without wildcards names one file, as it was recorded when it was indexed
+// ("docs/old.txt" and "./docs/old.txt" are the same file). A glob pattern is matched
+// like the include and exclude patterns of WalkOptions: without a "/" against the
+// file name ("*.pdf"), otherwise against the whole path ("docs/drafts/**"). Patterns
+// match files inside archives too ("bundle.zip!/docs/a.txt"); removing an archive
+// removes every file inside it.
+func (im *IndexManager) RemoveFiles(pattern string) (RemoveSummary, error) {
+	var summary RemoveSummary
+	if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+		return summary, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	if err := im.materialize(); err != nil {
+		return summary, err
+	}
+
+	files := im.indexedFiles()
+	for _, entries := range im.index {
+		for _, entry := range entries {
+			files[entry.OriginalFile] = true
+		}
+	}
+	for file := range files {
+		if matchFile(pattern, file) {
+			summary.Files = append(summary.Files, file)
+		}
+	}
+	slices.Sort(summary.Files)
+	summary.Entries = im.removeFiles(summary.Files)
+	return summary, nil
+}
+
+// matchFile reports whether pattern (see RemoveFiles) matches the source file of an entry
+func matchFile(pattern, file string) bool {
+	if !hasGlob(pattern) {
+		return filepath.Clean(pattern) == filepath.Clean(file)
+	}
+	file = filepath.ToSlash(filepath.Clean(file))
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	return matchAny([]string{pattern}, file, path.Base(file))
+}
@@ -0,0 +1,123 @@
+package internals
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Test that removing files drops their entries, their records and empty hash buckets
+func TestIndexManager_RemoveFiles(t *testing.T) {
+	root := makeTree(t, "docs/a.txt", "docs/b.txt", "docs/drafts/c.txt", "docs/drafts/d.txt")
+	path := func(name string) string { return filepath.Join(root, name) }
+	files, err := ExpandInput(root, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := NewIndexManager()
+	if err := im.IndexFiles(context.Background(), files, IndexOptions{ChunkSize: 8, Workers: 2}); err != nil {
+		t.Fatal(err)
+	}
+	entriesOf := func(file string) int {
+		n := 0
+		for _, entries := range im.index {
+			for _, entry := range entries {
+				if entry.OriginalFile == file {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	// a path names one file, however it is written
+	want := entriesOf(path("docs/a.txt"))
+	summary, err := im.RemoveFiles(filepath.Join(root, "docs", ".", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(summary.Files, []string{path("docs/a.txt")}) || summary.Entries != want {
+		t.Errorf("Expected %d entries of docs/a.txt removed, got %+v", want, summary)
+	}
+
+	// a glob without a "/" matches file names, one with a "/" whole paths
+	summary, err = im.RemoveFiles("b.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(summary.Files, []string{path("docs/b.txt")}) {
+		t.Errorf("Expected b.* to match docs/b.txt, got %v", summary.Files)
+	}
+	summary, err = im.RemoveFiles(filepath.ToSlash(root) + "/**/drafts/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(summary.Files, []string{path("docs/drafts/c.txt"), path("docs/drafts/d.txt")}) {
+		t.Errorf("Expected the drafts to match, got %v", summary.Files)
+	}
+
+	if im.Len() != 0 || len(im.index) != 0 || len(im.Files()) != 0 {
+		t.Errorf("Expected an empty index, got %d entries in %d buckets and %d file records", im.Len(), len(im.index), len(im.Files()))
+	}
+
+	summary, err = im.RemoveFiles("missing.txt")
+	if err != nil || len(summary.Files) != 0 || summary.Entries != 0 {
+		t.Errorf("Expected nothing removed for a missing file, got %+v, %v", summary, err)
+	}
+	if _, err := im.RemoveFiles("[z-"); err == nil {
+		t.Error("Expected error for an invalid pattern, but found none")
+	}
+}
+
+// Test that saving replaces the index file without leaving temporary files behind
+func TestIndexManager_SaveReplacesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.idx")
+	if err := testIndex(10).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	im := NewIndexManager()
+	if err := im.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := im.RemoveFiles("*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, []string{"index.idx", "index.idx.json"}) {
+		t.Errorf("Expected only the index and its JSON copy, got %v", names)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the index to keep mode 0600, got %v", info.Mode().Perm())
+	}
+
+	reloaded := NewIndexManager()
+	if err := reloaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if reloaded.Len() != 0 {
+		t.Errorf("Expected an empty index, got %d entries", reloaded.Len())
+	}
+}
@@ -0,0 +1,115 @@
+package internals
+
+import (
+	"fmt"
+	"strings"
+
+	idx "github.com/bravian1/Textblitz/internals/indexer"
+)
+
+// boundaries maps the boundary split modes to the boundary their chunks end on
+var boundaries = map[string]idx.Boundary{
+	"word":      idx.WordBoundary,
+	"sentence":  idx.SentenceBoundary,
+	"paragraph": idx.ParagraphBoundary,
+}
+
+// validate checks the chunking options
+func (opts IndexOptions) validate() error {
+	if opts.ChunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size: %d", opts.ChunkSize)
+	}
+	if opts.Tolerance < 0 || opts.MinSize < 0 || opts.MaxSize < 0 || opts.Stride < 0 {
+		return fmt.Errorf("split tolerance, stride and chunk size limits must not be negative")
+	}
+	if opts.Stride > opts.ChunkSize {
+		return fmt.Errorf("stride %d is longer than the chunk size %d", opts.Stride, opts.ChunkSize)
+	}
+	if opts.Stride > 0 && opts.split() != "bytes" {
+		return fmt.Errorf("a stride only applies to bytes splits, not %s", opts.split())
+	}
+	if _, err := idx.ParseType(opts.Type); err != nil {
+		return err
+	}
+	if _, err := idx.ParseEncoding(opts.Encoding); err != nil {
+		return err
+	}
+
+	if records := opts.recordOptions(); (len(records.Fields) > 0 || records.Key != "") && opts.split() != "record" {
+		return fmt.Errorf("fields and a key only apply to record splits, not %s", opts.split())
+	}
+
+	switch split := opts.split(); {
+	case split == "bytes", split == "record", boundaries[split] != 0:
+		return nil
+	case split == "cdc":
+		return opts.cdcSplitter().Validate()
+	default:
+		return fmt.Errorf("unknown split mode %q (use bytes, word, sentence, paragraph, cdc or record)", opts.Split)
+	}
+}
+
+// split returns the split mode, "bytes" if none was given
+func (opts IndexOptions) split() string {
+	split := strings.ToLower(strings.TrimSpace(opts.Split))
+	if split == "" {
+		return "bytes"
+	}
+	return split
+}
+
+// splitTolerance returns the tolerance boundary splits use, 0 for the other modes
+func (opts IndexOptions) splitTolerance() int {
+	if splitter, ok := opts.splitter().(idx.BoundarySplitter); ok {
+		return splitter.Tolerance
+	}
+	return 0
+}
+
+// stride returns the distance between the starts of two chunks when they overlap, 0 otherwise
+func (opts IndexOptions) stride() int {
+	if opts.split() == "bytes" && opts.Stride > 0 && opts.Stride < opts.ChunkSize {
+		return opts.Stride
+	}
+	return 0
+}
+
+// splitter returns the Splitter that cuts the input into chunks
+func (opts IndexOptions) splitter() idx.Splitter {
+	split := opts.split()
+	if boundary := boundaries[split]; boundary != 0 {
+		tolerance := opts.Tolerance
+		if tolerance == 0 {
+			tolerance = opts.ChunkSize / 4
+		}
+		return idx.BoundarySplitter{Size: opts.ChunkSize, Boundary: boundary, Tolerance: tolerance}
+	}
+	if split == "cdc" {
+		return opts.cdcSplitter()
+	}
+	return idx.FixedSplitter{Size: opts.ChunkSize, Stride: opts.stride()}
+}
+
+// recordOptions returns what record splits hash and identify records by
+func (opts IndexOptions) recordOptions() idx.RecordOptions {
+	var fields []string
+	for _, field := range opts.Fields {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return idx.RecordOptions{Fields: fields, Key: strings.TrimSpace(opts.Key)}
+}
+
+// cdcSplitter returns the content-defined splitter: ChunkSize is the average chunk size,
+// and the limits default to a quarter and four times that
+func (opts IndexOptions) cdcSplitter() idx.CDCSplitter {
+	splitter := idx.CDCSplitter{Min: opts.MinSize, Avg: opts.ChunkSize, Max: opts.MaxSize}
+	if splitter.Min == 0 {
+		splitter.Min = opts.ChunkSize / 4
+	}
+	if splitter.Max == 0 {
+		splitter.Max = opts.ChunkSize * 4
+	}
+	return splitter
+}
@@ -1,31 +1,313 @@
 package internals
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	idx "github.com/bravian1/Textblitz/internals/indexer"
 )
 
+// IndexOptions controls how input is chunked and hashed
+type IndexOptions struct {
+	ChunkSize   int            // chunk size in bytes
+	Workers     int            // number of worker goroutines hashing chunks
+	FileWorkers int            // number of files IndexFiles indexes at once (0 means 1)
+	Name        string         // OriginalFile label for chunks indexed from a reader ("stdin" if empty), see IndexReader
+	Features    FeatureOptions // how chunk text is broken into features before hashing
+
+	// Split picks where chunks end: "bytes" (default) cuts exactly every ChunkSize bytes;
+	// "word", "sentence" and "paragraph" end each chunk on the nearest such boundary,
+	// at most Tolerance bytes from ChunkSize (0 means ChunkSize/4); "cdc" cuts
+	// content-defined chunks between MinSize and MaxSize bytes, averaging ChunkSize
+	// (0 means ChunkSize/4 and ChunkSize*4); "record" makes every row of a CSV or TSV
+	// file, every object of a JSON lines file and every line of other text a chunk of
+	// its own, whatever its size (see Fields and Key)
+	Split     string
+	Tolerance int
+	MinSize   int
+	MaxSize   int
+
+	// Stride makes "bytes" chunks overlapping windows of ChunkSize bytes that start
+	// every Stride bytes; 0 means ChunkSize, no overlap
+	Stride int
+
+	// Type is the type of every input ("text", "pdf", "docx", "xml" or "html"), instead
+	// of the type detected from its content; see idx.ParseType
+	Type string
+
+	// Encoding is the encoding of every text input ("latin1", "windows-1252", "utf-16le",
+	// ...), instead of the encoding detected from its content; see idx.ParseEncoding.
+	// Text is indexed as UTF-8, and its entries record where their chunks are in the source.
+	Encoding string
+
+	// Fields are the columns or JSON fields of a record whose values are hashed, all of
+	// them if empty, and Key the one whose value identifies the record in its entry;
+	// "record" splits only, see idx.RecordOptions
+	Fields []string
+	Key    string
+
+	// OnSkip, if set, is called by IndexFiles for a file that isn't text, with what
+	// gave it away, and the file is left out instead of failing the run. It is also
+	// called for a file inside an archive that isn't text ("bundle.zip!/tool"), which
+	// is always left out. It is called by one goroutine at a time.
+	OnSkip func(file, reason string)
+
+	// OnWarning, if set, is called for a part of an input that couldn't be indexed and
+	// was left out, such as a line of a JSON lines file that isn't a JSON object, named
+	// "file:line", or a file IndexFiles couldn't read. It is called by one goroutine at
+	// a time.
+	OnWarning func(file string, err error)
+}
+
 // IndexFile processes a file, chunks it, computes simhashes for each chunk,
 // and saves the indexed data to a file. It uses a worker pool for parallel processing.
 func IndexFile(filename string, chunkSize int, numWorkers int, outputFile string) error {
 	// Create an index manager to store our results
 	indexManager := NewIndexManager()
 
-	// Use the Chunk function to read and chunk the file
-	chunks, err := idx.Chunk(filename, chunkSize)
+	opts := IndexOptions{ChunkSize: chunkSize, Workers: numWorkers}
+	if err := indexManager.IndexFile(context.Background(), filename, opts); err != nil {
+		return err
+	}
+
+	// If output file wasn't specified, generate one based on the input filename
+	if outputFile == "" {
+		outputFile = outputFilename(filename)
+	}
+
+	fmt.Printf("Saving index to: %s\n", outputFile)
+
+	// Save the index to disk
+	err := indexManager.Save(outputFile)
+	var jsonErr *JSONCopyError
+	switch {
+	case errors.As(err, &jsonErr):
+		fmt.Printf("Warning: %v\n", jsonErr)
+	case err != nil:
+		return fmt.Errorf("failed to save index: %w", err)
+	default:
+		fmt.Printf("Created human-readable index: %s\n", outputFile+".json")
+	}
+
+	return nil
+}
+
+// IndexFile chunks a file, hashes every chunk and adds the entries to the index.
+// The chunks are labelled with the filename.
+//
+// The type of the file is detected from its content unless opts.Type gives it (see
+// idx.WalkText). Every file inside a .zip or .tar archive is indexed on its own, its
+// chunks labelled with the archive and the path inside it, as in "bundle.zip!/docs/a.txt".
+// A file that isn't text fails with an *idx.BinaryError.
+func (im *IndexManager) IndexFile(ctx context.Context, filename string, opts IndexOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	// the file is recorded as it was before indexing started, so a change made
+	// while it is being indexed is picked up by the next update
+	record, err := statFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	file, err := os.Open(filename)
 	if err != nil {
 		return fmt.Errorf("failed to chunk file: %w", err)
 	}
+	defer file.Close()
+	if err := im.indexText(ctx, file, filename, opts); err != nil {
+		return err
+	}
+	im.setFile(record)
+	return nil
+}
+
+// indexText indexes the text of the input read from r, or of every file in it if it
+// is an archive, see idx.WalkText
+func (im *IndexManager) indexText(ctx context.Context, r io.Reader, name string, opts IndexOptions) error {
+	err := idx.WalkText(r, name, opts.readOptions(), opts.OnSkip, func(name string, text io.Reader) error {
+		return im.indexStream(ctx, text, name, opts)
+	})
+	if err != nil && err != ctx.Err() {
+		return fmt.Errorf("failed to chunk file: %w", err)
+	}
+	return err
+}
+
+// readOptions returns the type and encoding every input is read as, if they are given
+func (opts IndexOptions) readOptions() idx.ReadOptions {
+	typ, _ := idx.ParseType(opts.Type)
+	return idx.ReadOptions{Type: typ, Encoding: opts.encoding()}
+}
+
+// encoding returns the canonical name of the encoding given, "" if it is detected
+func (opts IndexOptions) encoding() string {
+	encoding, _ := idx.ParseEncoding(opts.Encoding)
+	return encoding
+}
+
+// IndexFiles indexes every file into one combined index, FileWorkers files at a time,
+// each with its own pool of Workers hashing its chunks. Every entry is labelled with
+// the file it came from.
+//
+// If a file can't be indexed, the files still in progress are stopped and an error
+// naming the file is returned. If opts.OnWarning is set, the error is passed to it
+// instead and the other files are indexed; the file isn't recorded, so an update tries
+// it again. Only if no file could be indexed are the errors of all of them returned.
+// A file that isn't text is passed to opts.OnSkip, if it is set, and the other files are
+// indexed; the skipped file is still recorded (see Files), so an update knows it hasn't
+// changed.
+func (im *IndexManager) IndexFiles(ctx context.Context, files []string, opts IndexOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	im.header = NewIndexHeader(opts)
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	var failed []error // files passed to onWarning
+	indexed := 0
+	onWarning := opts.OnWarning
+	if onWarning != nil {
+		opts.OnWarning = func(file string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			onWarning(file, err)
+		}
+	}
+	onSkip := opts.OnSkip
+	if onSkip != nil {
+		opts.OnSkip = func(file, reason string) {
+			mu.Lock()
+			defer mu.Unlock()
+			onSkip(file, reason)
+		}
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for range max(opts.FileWorkers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				// each file gets its own index, so the workers don't contend on im
+				fileIndex := NewIndexManager()
+				err := fileIndex.IndexFile(ctx, file, opts)
+
+				var binary *idx.BinaryError
+				mu.Lock()
+				switch {
+				case onSkip != nil && errors.As(err, &binary):
+					onSkip(file, binary.Reason)
+					if record, err := statFile(file); err == nil {
+						im.setFile(record)
+					}
+				case err != nil && onWarning != nil && ctx.Err() == nil:
+					failed = append(failed, fmt.Errorf("failed to index %s: %w", file, err))
+					onWarning(file, err)
+				case err != nil && firstErr == nil && ctx.Err() == nil:
+					firstErr = fmt.Errorf("failed to index %s: %w", file, err)
+					cancel()
+				case err == nil:
+					indexed++
+					err = im.addAll(fileIndex)
+					if err != nil && firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for _, file := range files {
+		select {
+		case jobs <- file:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	if firstErr == nil && indexed == 0 && len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+	return firstErr
+}
+
+// addAll adds every entry and source file record of other
+func (im *IndexManager) addAll(other *IndexManager) error {
+	for key, entries := range other.index {
+		for _, entry := range entries {
+			if err := im.Add(key, entry); err != nil {
+				return err
+			}
+		}
+	}
+	for _, record := range other.files {
+		im.setFile(record)
+	}
+	return nil
+}
+
+// IndexReader chunks text read from r, hashes every chunk and adds the entries to the index.
+// The chunks are labelled with opts.Name.
+//
+// The input is read the way IndexFile reads a file: its type is detected from its
+// content unless opts.Type gives it, compressed input is decompressed, and the files in
+// an archive are indexed one by one. opts.Name only helps tell XML from HTML markup.
+func (im *IndexManager) IndexReader(ctx context.Context, r io.Reader, opts IndexOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = "stdin"
+	}
+	return im.indexText(ctx, r, name, opts)
+}
+
+// indexStream splits r into chunks, hashes them with a worker pool and adds an entry for each one.
+//
+// Chunks go to the pool as they are read, so at most a few chunks per worker are held
+// in memory at once, however large the input is. If ctx is cancelled, reading stops
+// and ctx.Err() is returned.
+func (im *IndexManager) indexStream(ctx context.Context, r io.Reader, sourceFile string, opts IndexOptions) error {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if err := opts.Features.Validate(); err != nil {
+		return err
+	}
+
+	// Record how this index is built, so lookups can hash query text the same way
+	im.header = NewIndexHeader(opts)
 
 	// Create a worker pool for parallel processing
-	pool := idx.NewSimHashWorkerPool(numWorkers)
+	pool := idx.NewSimHashWorkerPoolWithFeatures(opts.Workers, opts.Features.NewFeatureSet())
 	pool.Start()
 
-	// Create a channel to collect results that's large enough to prevent blocking
+	// Create a channel to signal when all results have been collected
 	resultChan := make(chan bool)
 
 	// Process results in a background goroutine
@@ -35,13 +317,22 @@ func IndexFile(filename string, chunkSize int, numWorkers int, outputFile string
 			// Create an index entry for this chunk
 			entry := IndexEntry{
 				OriginalFile:    result.SourceFile,
-				Size:            len(result.Data),
+				Size:            result.Size,
 				Position:        result.Offset,
-				AssociatedWords: extractKeywords(string(result.Data), 10),
+				Line:            result.Location.Line,
+				EndLine:         result.Location.EndLine,
+				Column:          result.Location.Column,
+				RuneOffset:      result.Location.RuneOffset,
+				Page:            result.Location.Page,
+				EndPage:         result.Location.EndPage,
+				Section:         result.Location.Section,
+				Record:          result.Location.Record,
+				Key:             result.Location.Key,
+				AssociatedWords: extractKeywords(result.Data, 10),
 			}
 
 			// Add the entry to our index, keyed by its simhash
-			if err := indexManager.Add(strconv.FormatUint(result.Hash, 10), entry); err != nil {
+			if err := im.Add(strconv.FormatUint(result.Hash, 10), entry); err != nil {
 				fmt.Printf("Warning: failed to add entry to index: %v\n", err)
 			}
 		}
@@ -50,13 +341,65 @@ func IndexFile(filename string, chunkSize int, numWorkers int, outputFile string
 		resultChan <- true
 	}()
 
-	// Submit all chunks to the worker pool
-	for i, chunk := range chunks {
+	// Submit chunks to the worker pool as they are read, stopping early if the caller gives up.
+	// Submit blocks while the pool is busy, which keeps the reader from running ahead.
+	//
+	// Text decoded from another encoding is recorded by where its chunks are in the source,
+	// and the text of a document by the pages and sections its chunks are on.
+	id := 0
+	transcoder, _ := r.(*idx.Transcoder)
+	paged, _ := r.(*idx.PagedText)
+	submit := func(offset, length int, data []byte, location idx.Location) {
+		if paged != nil {
+			location.Page = paged.Page(offset)
+			location.EndPage = paged.Page(offset + max(length-1, 0))
+			location.Section = paged.Section(offset)
+		}
+		position, size := offset, length
+		if transcoder != nil {
+			position = transcoder.SourceOffset(offset)
+			size = transcoder.SourceOffset(offset+length) - position
+			transcoder.Forget(offset)
+		}
 		pool.Submit(idx.Task{
-			ID:         i,
-			Data:       chunk,
-			Offset:     i * chunkSize,
-			SourceFile: filename,
+			ID:         id,
+			Data:       data,
+			Offset:     position,
+			Size:       size,
+			Location:   location,
+			SourceFile: sourceFile,
+		})
+		id++
+	}
+
+	var err error
+	if opts.split() == "record" {
+		// a record is hashed by the text of its fields, but recorded by its bytes
+		records := opts.recordOptions()
+		if opts.OnWarning != nil {
+			records.OnInvalid = func(line int, err error) {
+				opts.OnWarning(fmt.Sprintf("%s:%d", sourceFile, line), err)
+			}
+		}
+		err = idx.SplitRecords(r, idx.RecordFormat(sourceFile), records, func(record idx.Record) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			submit(record.Offset, record.Size, record.Text, record.Location)
+			return nil
+		})
+	} else {
+		var locator idx.Locator
+		err = opts.splitter().Split(r, func(offset int, data []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			location, err := locator.Locate(offset, data)
+			if err != nil {
+				return err
+			}
+			submit(offset, len(data), data, location)
+			return nil
 		})
 	}
 
@@ -66,19 +409,10 @@ func IndexFile(filename string, chunkSize int, numWorkers int, outputFile string
 	// Wait for result processing to complete
 	<-resultChan
 
-	// If output file wasn't specified, generate one based on the input filename
-	if outputFile == "" {
-		outputFile = outputFilename(filename)
-	}
-
-	fmt.Printf("Saving index to: %s\n", outputFile)
-
-	// Save the index to disk
-	if err := indexManager.Save(outputFile); err != nil {
-		return fmt.Errorf("failed to save index: %w", err)
+	if err != nil && err != ctx.Err() {
+		return fmt.Errorf("failed to read input: %w", err)
 	}
-
-	return nil
+	return err
 }
 
 // outputFilename generates the index filename from the input filename
@@ -88,11 +422,16 @@ func outputFilename(inputFile string) string {
 	return baseName + ".idx"
 }
 
-// extractKeywords extracts a specified number of words from text for context
-func extractKeywords(text string, count int) []string {
-	words := strings.Fields(text)
-	if len(words) <= count {
-		return words
+// extractKeywords extracts a specified number of words from text for context.
+//
+// The words are copied, so the entry doesn't keep the whole chunk alive.
+func extractKeywords(text []byte, count int) []string {
+	words := make([]string, 0, count)
+	for word := range bytes.FieldsSeq(text) {
+		if len(words) == count {
+			break
+		}
+		words = append(words, string(word))
 	}
-	return words[:count]
+	return words
 }
@@ -0,0 +1,472 @@
+package internals
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	idx "github.com/bravian1/Textblitz/internals/indexer"
+)
+
+// repeatReader returns text over and over until size bytes have been read,
+// without ever holding more than one copy of text
+type repeatReader struct {
+	text string
+	size int
+	read int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.read >= r.size {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && r.read < r.size {
+		c := copy(p[n:min(len(p), n+r.size-r.read)], r.text[r.read%len(r.text):])
+		n += c
+		r.read += c
+	}
+	return n, nil
+}
+
+// Test that a large stream is indexed chunk by chunk with the right offsets
+func TestIndexManager_IndexReaderStream(t *testing.T) {
+	const chunkSize = 4096
+	const size = 8<<20 + 100 // a short last chunk
+
+	im := NewIndexManager()
+	input := &repeatReader{text: "All work and no play makes Jack a dull boy. ", size: size}
+	if err := im.IndexReader(context.Background(), input, IndexOptions{ChunkSize: chunkSize, Workers: 4, Name: "shining.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := (size + chunkSize - 1) / chunkSize
+	if im.Len() != chunks {
+		t.Fatalf("Expected %d entries, got %d", chunks, im.Len())
+	}
+	covered := 0
+	for _, entries := range im.index {
+		for _, entry := range entries {
+			if entry.Position%chunkSize != 0 || entry.OriginalFile != "shining.txt" {
+				t.Fatalf("unexpected entry %+v", entry)
+			}
+			covered += entry.Size
+		}
+	}
+	if covered != size {
+		t.Errorf("Expected the chunks to cover %d bytes, got %d", size, covered)
+	}
+	if last := im.EntriesAt("shining.txt", (chunks-1)*chunkSize); len(last) != 1 || last[0].Size != 100 {
+		t.Errorf("Expected a 100-byte last chunk, got %+v", last)
+	}
+}
+
+// Test that the error of a failing reader is returned
+func TestIndexManager_IndexReaderError(t *testing.T) {
+	input := io.MultiReader(strings.NewReader("some text"), iotest.ErrReader(errors.New("disk on fire")))
+	err := NewIndexManager().IndexReader(context.Background(), input, IndexOptions{ChunkSize: 4})
+	if err == nil || !strings.Contains(err.Error(), "disk on fire") {
+		t.Errorf("Expected the read error, got %v", err)
+	}
+}
+
+// makeDocx returns a minimal .docx document with one paragraph per string
+func makeDocx(t *testing.T, paragraphs ...string) []byte {
+	t.Helper()
+	var body strings.Builder
+	for _, p := range paragraphs {
+		body.WriteString("<w:p><w:r><w:t>" + p + "</w:t></w:r></w:p>")
+	}
+	return makeDocxBody(t, body.String())
+}
+
+// makeDocxBody returns a Word document whose body is the given WordprocessingML
+func makeDocxBody(t *testing.T, body string) []byte {
+	t.Helper()
+	parts := map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`,
+		"word/document.xml": `<?xml version="1.0"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+			`<w:body>` + body + `</w:body></w:document>`,
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Test that a reader is read as the document its content is, whatever it is named
+func TestIndexManager_IndexReaderDetect(t *testing.T) {
+	docx := makeDocx(t, "Quarterly report", "numbers went up")
+
+	im := NewIndexManager()
+	if err := im.IndexReader(context.Background(), bytes.NewReader(docx), IndexOptions{ChunkSize: 4096, Name: "report"}); err != nil {
+		t.Fatal(err)
+	}
+	entries := im.EntriesAt("report", 0)
+	if len(entries) != 1 || strings.Join(entries[0].AssociatedWords, " ") != "Quarterly report numbers went up" {
+		t.Errorf("Expected the text of the document, got %+v", entries)
+	}
+
+	im = NewIndexManager()
+	if err := im.IndexReader(context.Background(), strings.NewReader("<p>plain</p> text"), IndexOptions{ChunkSize: 4096, Name: "page.sql"}); err != nil {
+		t.Fatal(err)
+	}
+	entries = im.EntriesAt("page.sql", 0)
+	if len(entries) != 1 || strings.Join(entries[0].AssociatedWords, " ") != "<p>plain</p> text" {
+		t.Errorf("Expected the input as it is, got %+v", entries)
+	}
+}
+
+// Test that the chunks of a document record the page and the section they are on
+func TestIndexManager_IndexReaderPages(t *testing.T) {
+	heading := func(title string) string {
+		return `<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>` + title + `</w:t></w:r></w:p>`
+	}
+	docx := makeDocxBody(t, heading("1 Introduction")+
+		`<w:p><w:r><w:t>Wolves live in packs.</w:t></w:r><w:r><w:br w:type="page"/></w:r></w:p>`+
+		`<w:p><w:r><w:t>Each pack has a den.</w:t></w:r></w:p>`+
+		heading("2 Method")+
+		`<w:p><w:r><w:t>We counted the dens.</w:t></w:r></w:p>`)
+
+	im := NewIndexManager()
+	if err := im.IndexReader(context.Background(), bytes.NewReader(docx), IndexOptions{ChunkSize: 8, Name: "wolves.docx"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// page 2 starts with the second paragraph, the second section with its heading
+	text := "1 Introduction\nWolves live in packs.\nEach pack has a den.\n2 Method\nWe counted the dens."
+	page := func(offset int) int {
+		if offset < strings.Index(text, "Each") {
+			return 1
+		}
+		return 2
+	}
+	chunks := 0
+	for _, entries := range im.index {
+		for _, entry := range entries {
+			chunks++
+			section := "1 Introduction"
+			if entry.Position >= strings.Index(text, "2 Method") {
+				section = "2 Method"
+			}
+			if entry.Page != page(entry.Position) || entry.EndPage != page(entry.Position+entry.Size-1) || entry.Section != section {
+				t.Errorf("chunk %q: expected pages %d-%d in %q, got %+v", text[entry.Position:entry.Position+entry.Size],
+					page(entry.Position), page(entry.Position+entry.Size-1), section, entry)
+			}
+		}
+	}
+	if chunks != (len(text)+7)/8 {
+		t.Errorf("Expected %d chunks, got %d", (len(text)+7)/8, chunks)
+	}
+}
+
+// Test that every row of a CSV file is a chunk of its own, identified by its number and key
+func TestIndexManager_IndexReaderRecords(t *testing.T) {
+	csv := "id,name,city,updated\n" +
+		"c-1,Ada Lovelace,London,2024-01-02\n" +
+		"c-2,Charles Babbage,London,2024-01-03\n" +
+		"c-3,Ada Lovelace,London,2025-06-30\n"
+
+	im := NewIndexManager()
+	opts := IndexOptions{ChunkSize: 4096, Split: "record", Fields: []string{"name", "city"}, Key: "id", Name: "people.csv"}
+	if err := im.IndexReader(context.Background(), strings.NewReader(csv), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	first := im.EntriesAt("people.csv", strings.Index(csv, "c-1"))
+	dupe := im.EntriesAt("people.csv", strings.Index(csv, "c-3"))
+	if len(first) != 1 || first[0].Record != 1 || first[0].Key != "c-1" || first[0].Size != len("c-1,Ada Lovelace,London,2024-01-02") {
+		t.Fatalf("Expected record 1 with key c-1, got %+v", first)
+	}
+	if len(dupe) != 1 || dupe[0].Record != 3 || dupe[0].Key != "c-3" || dupe[0].Line != 4 {
+		t.Fatalf("Expected record 3 with key c-3 on line 4, got %+v", dupe)
+	}
+
+	// rows that only differ outside the hashed columns are exact duplicates
+	matches := im.Search(opts.Features.Hash("Ada Lovelace\nLondon"), SearchOptions{})
+	if len(matches) != 2 || matches[0].Key != "c-1" || matches[1].Key != "c-3" {
+		t.Errorf("Expected the two rows for Ada Lovelace, got %+v", matches)
+	}
+}
+
+// Test that a line of JSON lines that isn't an object is reported and the rest indexed
+func TestIndexManager_IndexReaderRecordsWarning(t *testing.T) {
+	jsonl := `{"msg": "disk full"}` + "\n" + `{"msg": "trunc` + "\n" + `{"msg": "disk full again"}` + "\n"
+
+	var warnings []string
+	im := NewIndexManager()
+	opts := IndexOptions{ChunkSize: 4096, Split: "record", Name: "app.jsonl", OnWarning: func(file string, err error) {
+		warnings = append(warnings, file)
+	}}
+	if err := im.IndexReader(context.Background(), strings.NewReader(jsonl), opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0] != "app.jsonl:2" {
+		t.Errorf("Expected a warning for app.jsonl:2, got %q", warnings)
+	}
+	if im.Len() != 2 {
+		t.Errorf("Expected the other 2 lines indexed, got %d entries", im.Len())
+	}
+}
+
+// Test that several files go into one index, each entry labelled with its file
+func TestIndexManager_IndexFiles(t *testing.T) {
+	root := makeTree(t, "a.txt", "b.txt", "sub/c.txt")
+	files, err := ExpandInput(root, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	im := NewIndexManager()
+	if err := im.IndexFiles(context.Background(), files, IndexOptions{ChunkSize: 8, Workers: 2, FileWorkers: 2}); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if entries := im.EntriesAt(file, 0); len(entries) != 1 {
+			t.Errorf("Expected the first chunk of %s, got %+v", file, entries)
+		}
+	}
+
+	missing := append(files, filepath.Join(root, "missing.txt"))
+	err = NewIndexManager().IndexFiles(context.Background(), missing, IndexOptions{ChunkSize: 8, FileWorkers: 2})
+	if err == nil || !strings.Contains(err.Error(), "missing.txt") {
+		t.Errorf("Expected an error naming the missing file, got %v", err)
+	}
+
+	var warnings []string
+	im = NewIndexManager()
+	opts := IndexOptions{ChunkSize: 8, FileWorkers: 2, OnWarning: func(file string, err error) {
+		warnings = append(warnings, file)
+	}}
+	if err := im.IndexFiles(context.Background(), missing, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0] != missing[len(files)] {
+		t.Errorf("Expected a warning for the missing file, got %q", warnings)
+	}
+	if len(im.Files()) != len(files) {
+		t.Errorf("Expected the other %d files indexed and recorded, got %+v", len(files), im.Files())
+	}
+	err = NewIndexManager().IndexFiles(context.Background(), missing[len(files):], opts)
+	if err == nil || !strings.Contains(err.Error(), "missing.txt") {
+		t.Errorf("Expected an error when no file could be indexed, got %v", err)
+	}
+}
+
+// Test that files that aren't text are skipped with the reason, or indexed as text if asked to
+func TestIndexManager_IndexFilesBinary(t *testing.T) {
+	root := makeTree(t, "a.txt")
+	binary := filepath.Join(root, "b.txt")
+	if err := os.WriteFile(binary, []byte("\x7fELF\x02\x01\x01\x00\x00\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{filepath.Join(root, "a.txt"), binary}
+
+	err := NewIndexManager().IndexFiles(context.Background(), files, IndexOptions{ChunkSize: 8})
+	var binaryErr *idx.BinaryError
+	if !errors.As(err, &binaryErr) {
+		t.Errorf("Expected a BinaryError, got %v", err)
+	}
+
+	var skipped []string
+	im := NewIndexManager()
+	opts := IndexOptions{ChunkSize: 8, OnSkip: func(file, reason string) {
+		skipped = append(skipped, file+": "+reason)
+	}}
+	if err := im.IndexFiles(context.Background(), files, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := binary + ": NUL byte at offset 7"; len(skipped) != 1 || skipped[0] != want {
+		t.Errorf("Expected %q to be skipped, got %q", want, skipped)
+	}
+	if len(im.EntriesAt(binary, 0)) != 0 {
+		t.Errorf("Expected nothing indexed from the skipped file")
+	}
+	// the skipped file is recorded, so an update knows it
+	if len(im.Files()) != 2 {
+		t.Errorf("Expected both files recorded, got %+v", im.Files())
+	}
+	summary, err := im.UpdateFiles(context.Background(), files, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (UpdateSummary{Unchanged: 2}) || len(skipped) != 1 {
+		t.Errorf("Expected both files unchanged and nothing skipped again, got %+v and %q", summary, skipped)
+	}
+
+	im = NewIndexManager()
+	opts.Type = "text"
+	if err := im.IndexFiles(context.Background(), files, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(im.EntriesAt(binary, 0)) != 1 {
+		t.Errorf("Expected the file indexed as text with --type text")
+	}
+}
+
+// Test that text in another encoding is hashed as UTF-8 and recorded by where it is in the file
+func TestIndexManager_IndexFileEncoded(t *testing.T) {
+	dir := t.TempDir()
+	utf8Path := filepath.Join(dir, "utf8.txt")
+	latin1Path := filepath.Join(dir, "latin1.txt")
+	if err := os.WriteFile(utf8Path, []byte("Voilà le café. Très bien, merci."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(latin1Path, []byte("Voil\xe0 le caf\xe9. Tr\xe8s bien, merci."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := make(map[string][]IndexEntry)
+	for _, path := range []string{utf8Path, latin1Path} {
+		im := NewIndexManager()
+		if err := im.IndexFile(context.Background(), path, IndexOptions{ChunkSize: 16, Split: "word"}); err != nil {
+			t.Fatal(err)
+		}
+		for key, entries := range im.index {
+			hashes[key] = append(hashes[key], entries...)
+		}
+	}
+
+	// the same text hashes the same, whatever it was encoded in
+	for key, entries := range hashes {
+		if len(entries) != 2 {
+			t.Fatalf("Expected both files to have a chunk with SimHash %s, got %+v", key, entries)
+		}
+		if entries[0].Line != entries[1].Line || entries[0].Column != entries[1].Column ||
+			strings.Join(entries[0].AssociatedWords, " ") != strings.Join(entries[1].AssociatedWords, " ") {
+			t.Errorf("Expected the same chunk in both files, got %+v", entries)
+		}
+	}
+
+	// the second chunk, "Très bien, merci.", starts after "Voilà le café. ": byte 15 of
+	// the Latin-1 file, byte 17 of the UTF-8 one
+	var latin1 []IndexEntry
+	for _, entries := range hashes {
+		for _, entry := range entries {
+			if entry.OriginalFile == latin1Path && entry.Position == 15 {
+				latin1 = append(latin1, entry)
+			}
+		}
+	}
+	if len(latin1) != 1 || latin1[0].Size != 17 || latin1[0].RuneOffset != 15 {
+		t.Errorf("Expected the second Latin-1 chunk at byte 15, 17 bytes long, got %+v", latin1)
+	}
+	excerpt, err := idx.NewChunkReader().Read(latin1Path, 15, 17, 0)
+	if err != nil || string(excerpt.Text) != "Très bien, merci." {
+		t.Errorf("Expected the chunk read back as UTF-8, got %q, %v", excerpt.Text, err)
+	}
+}
+
+// Test that a type given instead of the detected one is recorded, and chunks are read back as it
+func TestIndexManager_IndexFileType(t *testing.T) {
+	page := "<html><body><p>First paragraph of text.</p><p>Second paragraph.</p></body></html>"
+	path := filepath.Join(t.TempDir(), "page.html")
+	if err := os.WriteFile(path, []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	im := NewIndexManager()
+	if err := im.IndexFile(context.Background(), path, IndexOptions{ChunkSize: 40, Type: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(t.TempDir(), "page.idx")
+	if err := im.Save(indexPath); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewIndexManager()
+	if err := loaded.Load(indexPath); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Header().Type != "text" {
+		t.Fatalf("Expected the type in the header, got %q", loaded.Header().Type)
+	}
+	entries := loaded.EntriesAt(path, 40)
+	if len(entries) != 1 {
+		t.Fatalf("Expected a chunk at byte 40, got %+v", entries)
+	}
+	reader := idx.NewChunkReader()
+	reader.SetReadOptions(loaded.Header().ReadOptions())
+	excerpt, err := reader.Read(path, entries[0].Position, entries[0].Size, 0)
+	if err != nil || string(excerpt.Text) != page[40:80] {
+		t.Errorf("Expected the raw bytes %q read back, got %q, %v", page[40:80], excerpt.Text, err)
+	}
+}
+
+// Test that the files inside an archive are indexed, updated and removed with the archive
+func TestIndexManager_IndexArchive(t *testing.T) {
+	root := makeTree(t, "a.txt")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"docs/b.txt", "docs/c.txt", "image.png"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, "some text in "+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(root, "bundle.zip")
+	if err := os.WriteFile(bundle, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ExpandInput(root, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := NewIndexManager()
+	opts := IndexOptions{ChunkSize: 4096}
+	if err := im.IndexFiles(context.Background(), files, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join(root, "a.txt"), bundle + "!/docs/b.txt", bundle + "!/docs/c.txt"} {
+		if len(im.EntriesAt(name, 0)) != 1 {
+			t.Errorf("Expected an entry for %s", name)
+		}
+	}
+	if im.Len() != 3 || len(im.Files()) != 2 {
+		t.Errorf("Expected 3 entries of 2 files, got %d entries and %+v", im.Len(), im.Files())
+	}
+
+	// the archive is one file to an update
+	summary, err := im.UpdateFiles(context.Background(), files, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (UpdateSummary{Unchanged: 2}) {
+		t.Errorf("Expected both files unchanged, got %+v", summary)
+	}
+
+	removed, err := im.RemoveFiles(bundle + "!/docs/b.txt")
+	if err != nil || removed.Entries != 1 || im.Len() != 2 {
+		t.Errorf("Expected one entry removed, got %+v, %v", removed, err)
+	}
+	removed, err = im.RemoveFiles(bundle)
+	if err != nil || removed.Entries != 1 || im.Len() != 1 || len(im.Files()) != 1 {
+		t.Errorf("Expected the rest of the archive removed, got %+v, %v", removed, err)
+	}
+}
@@ -0,0 +1,214 @@
+package internals
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	idx "github.com/bravian1/Textblitz/internals/indexer"
+)
+
+// WalkOptions controls which files a directory or glob input expands to.
+//
+// Patterns use path.Match syntax plus "**", which matches any number of directories.
+// A pattern without a "/" is matched against the file name, anything else against
+// the path below the directory being walked ("drafts/**", "**/old/*.txt").
+type WalkOptions struct {
+	Include        []string // files must match one of these; by default, files OpenText can read
+	Exclude        []string // files and directories matching any of these are skipped
+	FollowSymlinks bool     // index linked files and walk into linked directories, instead of skipping links
+}
+
+// validate checks the include and exclude patterns
+func (opts WalkOptions) validate() error {
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ExpandInput returns the files to index for input, in a stable order:
+//   - a file is returned as it is
+//   - a directory is walked recursively, and the files in it that pass the
+//     include and exclude patterns are returned
+//   - a glob pattern ("docs/**/*.txt") walks the directory before its first
+//     wildcard and returns the files that match it and pass the patterns
+func ExpandInput(input string, opts WalkOptions) ([]string, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var w *walker
+	if hasGlob(input) {
+		root, pattern := splitGlob(input)
+		if err := (WalkOptions{Include: []string{strings.Join(pattern, "/")}}).validate(); err != nil {
+			return nil, err
+		}
+		w = &walker{root: root, pattern: pattern, opts: opts}
+	} else {
+		info, err := os.Stat(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input: %w", err)
+		}
+		if !info.IsDir() {
+			return []string{input}, nil
+		}
+		w = &walker{root: input, opts: opts}
+	}
+
+	if err := w.walkRoot(); err != nil {
+		return nil, err
+	}
+	if len(w.files) == 0 {
+		return nil, fmt.Errorf("no files to index in %s", input)
+	}
+	return w.files, nil
+}
+
+// walker collects the files below root
+type walker struct {
+	root    string
+	pattern []string // glob pattern segments below root, nil for a directory input
+	opts    WalkOptions
+	visited map[string]bool // real paths of the directories walked, to stop symlink loops
+	files   []string
+}
+
+func (w *walker) walkRoot() error {
+	info, err := os.Stat(w.root)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("failed to read input: %s is not a directory", w.root)
+	}
+	w.visited = make(map[string]bool)
+	return w.walk(w.root, "")
+}
+
+// walk adds the files in dir, whose path below root is rel
+func (w *walker) walk(dir, rel string) error {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if w.visited[real] {
+			return nil
+		}
+		w.visited[real] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		full := filepath.Join(dir, name)
+		relPath := path.Join(rel, name)
+
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			info, err := os.Stat(full)
+			if err != nil {
+				continue // a broken link
+			}
+			isDir = info.IsDir()
+		} else if !isDir && !entry.Type().IsRegular() {
+			continue // devices, sockets and pipes
+		}
+
+		if matchAny(w.opts.Exclude, relPath, name) {
+			continue
+		}
+		if isDir {
+			if err := w.walk(full, relPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if w.wanted(relPath, name) {
+			w.files = append(w.files, full)
+		}
+	}
+	return nil
+}
+
+// wanted reports whether a file passes the glob pattern and the include patterns
+func (w *walker) wanted(rel, name string) bool {
+	if w.pattern != nil && !matchSegments(w.pattern, strings.Split(rel, "/")) {
+		return false
+	}
+	if len(w.opts.Include) > 0 {
+		return matchAny(w.opts.Include, rel, name)
+	}
+	// a glob pattern already says which files are wanted
+	return w.pattern != nil || idx.Supported(name)
+}
+
+// matchAny reports whether any of patterns matches a file or directory (see WalkOptions)
+func matchAny(patterns []string, rel, name string) bool {
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+			continue
+		}
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, where "**" matches
+// any number of segments and every other pattern segment matches exactly one
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(segments); skip++ {
+				if matchSegments(pattern[1:], segments[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+func hasGlob(input string) bool {
+	return strings.ContainsAny(input, "*?[")
+}
+
+// splitGlob splits a glob pattern into the directory before its first wildcard
+// and the pattern segments below it
+func splitGlob(input string) (string, []string) {
+	segments := strings.Split(filepath.ToSlash(input), "/")
+	i := 0
+	for i < len(segments)-1 && !hasGlob(segments[i]) {
+		i++
+	}
+	root := strings.Join(segments[:i], "/")
+	switch {
+	case root == "" && i > 0:
+		root = "/"
+	case root == "":
+		root = "."
+	}
+	return filepath.FromSlash(root), segments[i:]
+}
@@ -0,0 +1,109 @@
+package internals
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// makeTree creates files (paths relative to a new temporary directory) and returns the directory
+func makeTree(t *testing.T, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("some text in "+file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// relative strips root from the expanded paths
+func relative(t *testing.T, root string, files []string) []string {
+	t.Helper()
+	rel := make([]string, len(files))
+	for i, file := range files {
+		r, err := filepath.Rel(root, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel[i] = filepath.ToSlash(r)
+	}
+	return rel
+}
+
+func TestExpandInput(t *testing.T) {
+	root := makeTree(t,
+		"a.txt", "b.pdf", "notes.md",
+		"docs/c.txt", "docs/drafts/d.txt", "docs/deep/er/e.docx",
+		"build/f.txt",
+	)
+
+	tests := []struct {
+		name  string
+		input string
+		opts  WalkOptions
+		want  []string
+	}{
+		{"directory", root, WalkOptions{},
+			[]string{"a.txt", "b.pdf", "build/f.txt", "docs/c.txt", "docs/deep/er/e.docx", "docs/drafts/d.txt"}},
+		{"exclude names and paths", root, WalkOptions{Exclude: []string{"build", "docs/drafts/**", "*.pdf"}},
+			[]string{"a.txt", "docs/c.txt", "docs/deep/er/e.docx"}},
+		{"include", root, WalkOptions{Include: []string{"*.md", "docs/**/*.docx"}},
+			[]string{"docs/deep/er/e.docx", "notes.md"}},
+		{"glob", filepath.Join(root, "docs", "**", "*.txt"), WalkOptions{},
+			[]string{"docs/c.txt", "docs/drafts/d.txt"}},
+		{"glob with exclude", filepath.Join(root, "*", "*.txt"), WalkOptions{Exclude: []string{"build"}},
+			[]string{"docs/c.txt"}},
+		{"file", filepath.Join(root, "notes.md"), WalkOptions{Exclude: []string{"*.md"}},
+			[]string{"notes.md"}},
+	}
+	for _, tt := range tests {
+		files, err := ExpandInput(tt.input, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := relative(t, root, files); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := ExpandInput(filepath.Join(root, "*.zip"), WalkOptions{}); err == nil {
+		t.Error("Expected an error for a glob that matches nothing, but found none")
+	}
+	if _, err := ExpandInput(root, WalkOptions{Include: []string{"[a-"}}); err == nil {
+		t.Error("Expected an error for an invalid pattern, but found none")
+	}
+}
+
+func TestExpandInput_Symlinks(t *testing.T) {
+	root := makeTree(t, "docs/a.txt", "other/b.txt")
+	if err := os.Symlink(filepath.Join(root, "other"), filepath.Join(root, "docs", "linked")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	// a link back up the tree must not be walked forever
+	if err := os.Symlink(root, filepath.Join(root, "other", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ExpandInput(filepath.Join(root, "docs"), WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := relative(t, root, files), []string{"docs/a.txt"}; !slices.Equal(got, want) {
+		t.Errorf("skipping links: got %v, want %v", got, want)
+	}
+
+	files, err = ExpandInput(filepath.Join(root, "docs"), WalkOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := relative(t, root, files), []string{"docs/a.txt", "docs/linked/b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("following links: got %v, want %v", got, want)
+	}
+}
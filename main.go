@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"slices"
 
 	"github.com/bravian1/Textblitz/internals"
+	"github.com/bravian1/Textblitz/textblitz"
 )
 
 func main() {
@@ -13,25 +20,408 @@ func main() {
 		return
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	switch config.Command {
 	case "index":
 		fmt.Println("Performing indexing...")
-		if err := internals.IndexFile(config.InputFile, config.ChunkSize, config.WorkerPool, config.OutputFile); err != nil {
+		if err := index(ctx, config); err != nil {
 			fmt.Printf("Error during indexing: %v\n", err)
 			return
 		}
-		fmt.Printf("Successfully indexed %s\n", config.InputFile)
+		fmt.Printf("Successfully indexed %s\n", inputName(config))
 	case "lookup":
-		fmt.Println("Performing lookup...")
-
-		indexManager := internals.NewIndexManager()
-
-		if err := indexManager.LookUp(config.InputFile, config.SimHash, config.Threshold); err!= nil{
+		if !config.JSON && !config.Links {
+			fmt.Println("Performing lookup...")
+		}
+		if err := lookup(config); err != nil {
 			fmt.Printf("Error during lookup: %v\n", err)
 			return
 		}
-		
+	case "batch":
+		if err := batch(ctx, config); err != nil {
+			fmt.Printf("Error during batch lookup: %v\n", err)
+			return
+		}
+	case "show":
+		if err := show(config); err != nil {
+			fmt.Printf("Error during show: %v\n", err)
+			return
+		}
+	case "hash":
+		if err := hash(config); err != nil {
+			fmt.Printf("Error during hash: %v\n", err)
+			return
+		}
+	case "remove":
+		if err := remove(config); err != nil {
+			fmt.Printf("Error during remove: %v\n", err)
+			return
+		}
+	case "merge":
+		if err := merge(config); err != nil {
+			fmt.Printf("Error during merge: %v\n", err)
+			return
+		}
+
+	default:
+		fmt.Println("Invalid command. Use 'index', 'lookup', 'batch', 'show', 'hash', 'merge' or 'remove'.\n or --help for more information.")
+	}
+}
+
+// index builds an index of the input file, directory, glob or stdin and saves it to the output file
+func index(ctx context.Context, config internals.CLIFlags) error {
+	var searcher *textblitz.Searcher
+	opts, report := indexOptions(config)
+	if config.InputFile == "-" {
+		var err error
+		searcher, err = textblitz.Index(ctx, os.Stdin, opts)
+		var binary *textblitz.BinaryError
+		if errors.As(err, &binary) {
+			return fmt.Errorf("%v; use --type text to index it anyway", err)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		files, err := textblitz.ExpandInput(config.InputFile, config.WalkOptions())
+		if err != nil {
+			return err
+		}
+		if config.Update {
+			return update(ctx, config, files)
+		}
+		if len(files) > 1 {
+			fmt.Printf("Indexing %d files...\n", len(files))
+		}
+
+		searcher, err = textblitz.IndexFiles(ctx, files, opts)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(files, func(file string) bool { return !report.skipped[file] }) {
+			return fmt.Errorf("none of the input is text; use --type text to index it anyway")
+		}
+	}
+	if report.warnings > 0 {
+		fmt.Printf("Parts of the input left out: %d\n", report.warnings)
+	}
+	searcher.SetHashFormat(config.Format())
+
+	return saveIndex(searcher, config.OutputFile)
+}
+
+// saveIndex saves the index to path, warning if its JSON copy couldn't be written
+func saveIndex(searcher *textblitz.Searcher, path string) error {
+	fmt.Printf("Saving index to: %s\n", path)
+	err := searcher.Save(path)
+	var jsonErr *textblitz.JSONCopyError
+	switch {
+	case errors.As(err, &jsonErr):
+		fmt.Printf("Warning: %v\n", jsonErr)
+	case err != nil:
+		return fmt.Errorf("failed to save index: %w", err)
 	default:
-		fmt.Println("Invalid command. Use 'index' or 'lookup'.\n or --help for more information.")
+		fmt.Printf("Created human-readable index: %s\n", path+".json")
+	}
+	return nil
+}
+
+// inputReport counts what indexing left out of the input
+type inputReport struct {
+	skipped  map[string]bool // files, and files inside archives, that aren't text
+	warnings int             // parts of the input that couldn't be indexed
+}
+
+// indexOptions returns the index options of the flags, with files that aren't text and
+// parts of the input that can't be indexed reported and left out; report counts them
+func indexOptions(config internals.CLIFlags) (opts textblitz.IndexOptions, report *inputReport) {
+	report = &inputReport{skipped: map[string]bool{}}
+	opts = config.IndexOptions()
+	opts.OnSkip = func(file, reason string) {
+		report.skipped[file] = true
+		fmt.Printf("Skipping %s: not text (%s)\n", file, reason)
+	}
+	opts.OnWarning = func(file string, err error) {
+		report.warnings++
+		fmt.Printf("Warning: leaving out %s: %v\n", file, err)
+	}
+	return opts, report
+}
+
+// inputName is how the index input is reported: the -i path, or the --name of stdin
+func inputName(config internals.CLIFlags) string {
+	if config.InputFile != "-" {
+		return config.InputFile
+	}
+	if config.Name != "" {
+		return config.Name
+	}
+	return "stdin"
+}
+
+// update brings the index at the output file up to date with files, indexing only the
+// files that changed. Without an index there yet, every file is indexed.
+func update(ctx context.Context, config internals.CLIFlags, files []string) error {
+	opts, _ := indexOptions(config)
+	searcher, err := textblitz.Open(config.OutputFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("No index at %s yet, indexing every file\n", config.OutputFile)
+		searcher, err = textblitz.IndexFiles(ctx, files, opts)
+		if err != nil {
+			return err
+		}
+		return saveUpdate(searcher, config, textblitz.UpdateSummary{Added: len(files)})
+	}
+	if err != nil {
+		return fmt.Errorf("Error loading index: %v", err)
+	}
+	defer searcher.Close()
+
+	// files are chunked the way the index was; explicit chunking flags must agree with it
+	if config.ChunkingSet {
+		if err := searcher.Header().CheckChunking(config.IndexOptions()); err != nil {
+			return fmt.Errorf("%v; drop the chunking and feature flags to use the index settings, or rebuild the index without --update", err)
+		}
+	}
+
+	summary, err := searcher.Update(ctx, files, opts)
+	if err != nil {
+		return err
+	}
+	return saveUpdate(searcher, config, summary)
+}
+
+// saveUpdate prints the update summary and saves the index if anything changed
+func saveUpdate(searcher *textblitz.Searcher, config internals.CLIFlags, summary textblitz.UpdateSummary) error {
+	fmt.Printf("%d added, %d changed, %d removed, %d unchanged\n", summary.Added, summary.Changed, summary.Removed, summary.Unchanged)
+	if !summary.Modified() {
+		fmt.Printf("%s is up to date\n", config.OutputFile)
+		return nil
+	}
+
+	searcher.SetHashFormat(config.Format())
+	return saveIndex(searcher, config.OutputFile)
+}
+
+// merge combines the indexes listed after the flags into one and saves it to the output file
+func merge(config internals.CLIFlags) error {
+	fmt.Printf("Merging %d indexes...\n", len(config.Indexes))
+	searcher, summary, err := textblitz.Merge(config.Indexes)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d entries, %d duplicates removed\n", summary.Entries, summary.Duplicates)
+
+	searcher.SetHashFormat(config.Format())
+	return saveIndex(searcher, config.OutputFile)
+}
+
+// remove drops the entries of the --file files from the index and saves it in place
+func remove(config internals.CLIFlags) error {
+	searcher, err := textblitz.Open(config.InputFile)
+	if err != nil {
+		return fmt.Errorf("Error loading index: %v", err)
+	}
+	defer searcher.Close()
+
+	summary, err := searcher.Remove(config.SourceFile)
+	if err != nil {
+		return err
+	}
+	if len(summary.Files) == 0 {
+		return fmt.Errorf("no file in %s matches %s", config.InputFile, config.SourceFile)
+	}
+	for _, file := range summary.Files {
+		fmt.Printf("Removing %s\n", file)
+	}
+	fmt.Printf("%d entries of %d files removed\n", summary.Entries, len(summary.Files))
+
+	searcher.SetHashFormat(config.Format())
+	return saveIndex(searcher, config.InputFile)
+}
+
+// lookup searches the index for the -h SimHash, or for the hash of the -q/-f query text
+func lookup(config internals.CLIFlags) error {
+	searcher, err := textblitz.Open(config.InputFile)
+	if err != nil {
+		return fmt.Errorf("Error loading index: %v", err)
+	}
+	defer searcher.Close()
+
+	query, err := queryFromFlags(config, searcher)
+	if err != nil {
+		return err
+	}
+
+	matches, err := searcher.Search(query, textblitz.SearchOptions{
+		Threshold: config.Threshold,
+		TopK:      config.TopK,
+		Offset:    config.Offset,
+	})
+	if err != nil {
+		return err
+	}
+
+	if config.JSON {
+		return internals.LookUpJSON(matches, config.Format())
+	}
+	if len(matches) == 0 {
+		hash, _ := searcher.HashQuery(query)
+		return fmt.Errorf("No fuzzy matches found for SimHash: %s with threshold %d", hash.Format(config.Format()), config.Threshold)
+	}
+	if config.Links {
+		internals.LookUpLinks(matches, config.Format())
+		return nil
+	}
+	if config.WithText {
+		internals.LookUpOutputWithText(matches, config.Context, config.Format(), searcher.Header())
+		return nil
+	}
+	internals.LookUpOutput(matches, config.Format())
+	return nil
+}
+
+// queryFromFlags builds the search query from -h, or from the -q/-f query text.
+//
+// Query text is hashed the way the index was built. Feature flags given explicitly must
+// match the index header; for an index without a header there is nothing to check
+// against, so a warning is printed instead.
+func queryFromFlags(config internals.CLIFlags, searcher *textblitz.Searcher) (textblitz.Query, error) {
+	if config.SimHash != "" {
+		hash, err := textblitz.ParseHash(config.SimHash)
+		if err != nil {
+			return textblitz.Query{}, err
+		}
+		return textblitz.HashQuery(hash), nil
+	}
+
+	text, err := internals.ReadQuery(config.QueryText, config.QueryFile)
+	if err != nil {
+		return textblitz.Query{}, fmt.Errorf("failed to read query: %w", err)
+	}
+	query := textblitz.TextQuery(text)
+	if config.FeaturesSet {
+		query = query.WithFeatures(config.Features())
+	}
+	warnUnknownFeatures(searcher, config)
+
+	hash, err := searcher.HashQuery(query)
+	if err != nil {
+		return textblitz.Query{}, fmt.Errorf("%v; drop the feature flags to use the index settings, or rebuild the index", err)
+	}
+	if !config.JSON && !config.Links {
+		fmt.Printf("Query SimHash: %s\n", hash.Format(config.Format()))
+	}
+	return query, nil
+}
+
+// warnUnknownFeatures warns that query text can't be checked against an index without a header
+func warnUnknownFeatures(searcher *textblitz.Searcher, config internals.CLIFlags) {
+	if searcher.Header().Known() {
+		return
+	}
+	features := textblitz.FeatureOptions{}
+	if config.FeaturesSet {
+		features = config.Features()
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s has no header recording how it was hashed (written by an older version); "+
+		"query text is hashed with %s features, which may not match the index\n", config.InputFile, features)
+}
+
+// hash prints the SimHash of the -q/-f text. With -i, the text is hashed the way that
+// index was built, so the result can be used in lookups against it.
+func hash(config internals.CLIFlags) error {
+	text, err := internals.ReadQuery(config.QueryText, config.QueryFile)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	if config.InputFile == "" {
+		fmt.Println(config.Features().Hash(text).Format(config.Format()))
+		return nil
+	}
+
+	searcher, err := textblitz.Open(config.InputFile)
+	if err != nil {
+		return fmt.Errorf("Error loading index: %v", err)
+	}
+	defer searcher.Close()
+	query := textblitz.TextQuery(text)
+	if config.FeaturesSet {
+		query = query.WithFeatures(config.Features())
+	}
+	warnUnknownFeatures(searcher, config)
+
+	hash, err := searcher.HashQuery(query)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash.Format(config.Format()))
+	return nil
+}
+
+// batch loads the index once and looks up every query from the -f file (or stdin)
+func batch(ctx context.Context, config internals.CLIFlags) error {
+	input := os.Stdin
+	if config.QueryFile != "-" {
+		file, err := os.Open(config.QueryFile)
+		if err != nil {
+			return fmt.Errorf("failed to open query file: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	queries, err := textblitz.ReadBatch(input, config.TextQueries)
+	if err != nil {
+		return err
+	}
+
+	searcher, err := textblitz.Open(config.InputFile)
+	if err != nil {
+		return fmt.Errorf("Error loading index: %v", err)
+	}
+	defer searcher.Close()
+
+	// text queries are hashed with the index settings; explicit feature flags must agree with them
+	if config.FeaturesSet {
+		if err := searcher.CheckFeatures(config.Features()); err != nil {
+			return fmt.Errorf("%v; drop the feature flags to use the index settings, or rebuild the index", err)
+		}
+	}
+	if config.TextQueries {
+		warnUnknownFeatures(searcher, config)
+	}
+
+	results := searcher.SearchBatch(ctx, queries, textblitz.SearchOptions{
+		Threshold: config.Threshold,
+		TopK:      config.TopK,
+		Offset:    config.Offset,
+	}, config.WorkerPool)
+
+	if config.JSON {
+		return internals.BatchJSON(results, config.Format())
+	}
+	internals.BatchOutput(results, config.Format())
+	return nil
+}
+
+// show prints the chunk that starts at -p, read back from its source file
+func show(config internals.CLIFlags) error {
+	searcher, err := textblitz.Open(config.InputFile)
+	if err != nil {
+		return fmt.Errorf("Error loading index: %v", err)
+	}
+	defer searcher.Close()
+
+	entries := searcher.EntriesAt(config.SourceFile, config.Position)
+	if len(entries) == 0 {
+		if config.SourceFile != "" {
+			return fmt.Errorf("no chunk of %s starts at byte %d", config.SourceFile, config.Position)
+		}
+		return fmt.Errorf("no chunk starts at byte %d", config.Position)
 	}
+	return internals.ShowOutput(entries, config.Context, searcher.Header())
 }
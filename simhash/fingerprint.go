@@ -0,0 +1,111 @@
+package simhash
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fingerprint is a 64-bit SimHash value.
+type Fingerprint uint64
+
+// Format is how a Fingerprint is written out.
+type Format int
+
+const (
+	// Decimal writes fingerprints as base-10 integers, e.g. 1076739750722064764
+	Decimal Format = iota
+	// Hex writes fingerprints as 0x-prefixed, zero-padded hexadecimal, e.g. 0x0ef14d2c1a7e3f7c
+	Hex
+	// Binary writes fingerprints as 64 binary digits, most significant bit first
+	Binary
+)
+
+// ParseFormat parses a format name: "decimal" (or "dec"), "hex" or "binary" (or "bin").
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "decimal", "dec", "":
+		return Decimal, nil
+	case "hex", "hexadecimal":
+		return Hex, nil
+	case "binary", "bin":
+		return Binary, nil
+	default:
+		return Decimal, fmt.Errorf("unknown hash format %q (use decimal, hex or binary)", name)
+	}
+}
+
+// String returns the format's name
+func (f Format) String() string {
+	switch f {
+	case Hex:
+		return "hex"
+	case Binary:
+		return "binary"
+	default:
+		return "decimal"
+	}
+}
+
+// ParseFingerprint parses a fingerprint written in any of the supported forms:
+//   - 0x or 0X prefix: hexadecimal (up to 16 digits)
+//   - 0b or 0B prefix followed only by 0s and 1s, or exactly 64 characters of 0s and 1s: binary
+//   - only decimal digits: decimal
+//   - otherwise, hex digits without a prefix: hexadecimal
+//
+// A string of decimal digits is always read as decimal; use the 0x prefix for hex values
+// that happen to contain no letters. Likewise 0b followed only by 0s and 1s is always
+// binary, but unprefixed hex that starts with 0b and goes on with other digits, such as
+// 0b1a2c3d4e5f6071, is read as hex.
+func ParseFingerprint(s string) (Fingerprint, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty SimHash")
+	}
+
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		return parseFingerprint(s, lower[2:], 16)
+	case strings.HasPrefix(lower, "0b") && len(lower) > 2 && strings.Trim(lower[2:], "01") == "":
+		return parseFingerprint(s, lower[2:], 2)
+	case len(lower) == 64 && strings.Trim(lower, "01") == "":
+		return parseFingerprint(s, lower, 2)
+	case strings.Trim(lower, "0123456789") == "":
+		return parseFingerprint(s, lower, 10)
+	default:
+		return parseFingerprint(s, lower, 16)
+	}
+}
+
+// parseFingerprint parses digits in the given base, reporting errors against the original input
+func parseFingerprint(input, digits string, base int) (Fingerprint, error) {
+	if digits == "" {
+		return 0, fmt.Errorf("invalid SimHash %q: no digits", input)
+	}
+	value, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return 0, fmt.Errorf("invalid SimHash %q: does not fit in 64 bits", input)
+		}
+		return 0, fmt.Errorf("invalid SimHash %q: not a decimal, hex or binary value", input)
+	}
+	return Fingerprint(value), nil
+}
+
+// Format writes the fingerprint in the given format. Every format parses back with ParseFingerprint.
+func (f Fingerprint) Format(format Format) string {
+	switch format {
+	case Hex:
+		return fmt.Sprintf("0x%016x", uint64(f))
+	case Binary:
+		return fmt.Sprintf("%064b", uint64(f))
+	default:
+		return strconv.FormatUint(uint64(f), 10)
+	}
+}
+
+// String writes the fingerprint in decimal
+func (f Fingerprint) String() string {
+	return f.Format(Decimal)
+}
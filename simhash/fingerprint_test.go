@@ -0,0 +1,66 @@
+package simhash
+
+import "testing"
+
+func TestParseFingerprint(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Fingerprint
+		wantErr bool
+	}{
+		{name: "decimal", input: "1076739750722064764", want: 1076739750722064764},
+		{name: "hex without prefix", input: "3e4f1b2c98a61", want: 0x3e4f1b2c98a61},
+		{name: "hex with prefix", input: "0x3E4F1B2C98A61", want: 0x3e4f1b2c98a61},
+		{name: "hex prefix with digits only", input: "0x1234", want: 0x1234},
+		{name: "binary with prefix", input: "0b1011", want: 0b1011},
+		{name: "hex starting with 0b", input: "0b1a2c3d4e5f6071", want: 0x0b1a2c3d4e5f6071},
+		{name: "0b alone is hex", input: "0B", want: 0xb},
+		{name: "64-digit binary", input: "1000000000000000000000000000000000000000000000000000000000000001", want: 1<<63 | 1},
+		{name: "surrounding spaces", input: "  42\n", want: 42},
+		{name: "max value", input: "0xffffffffffffffff", want: 1<<64 - 1},
+		{name: "empty", input: "", wantErr: true},
+		{name: "prefix only", input: "0x", wantErr: true},
+		{name: "too many hex digits", input: "0x1ffffffffffffffff", wantErr: true},
+		{name: "decimal overflow", input: "18446744073709551616", wantErr: true},
+		{name: "not a number", input: "zz-top", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFingerprint(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFingerprint(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprintFormatRoundTrip(t *testing.T) {
+	values := []Fingerprint{0, 1, 0x3e4f1b2c98a61, 1<<63 | 5, 1<<64 - 1}
+	for _, format := range []Format{Decimal, Hex, Binary} {
+		for _, value := range values {
+			text := value.Format(format)
+			parsed, err := ParseFingerprint(text)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			if parsed != value {
+				t.Errorf("%s: %d formatted as %q parsed back as %d", format, value, text, parsed)
+			}
+		}
+	}
+
+	if got := Fingerprint(0xab).Format(Hex); got != "0x00000000000000ab" {
+		t.Errorf("hex format = %q", got)
+	}
+}
@@ -0,0 +1,138 @@
+package simhash
+
+import (
+	"math/bits"
+	"slices"
+	"sync"
+)
+
+// MaxTableBlocks is the largest number of blocks a Table splits fingerprints into.
+// A search with threshold k needs k+1 blocks; past this point the blocks are only
+// a few bits wide, nearly every fingerprint becomes a candidate, and a plain scan is faster.
+const MaxTableBlocks = 16
+
+// Table finds fingerprints within a Hamming distance of a query without comparing
+// the query against every fingerprint.
+//
+// It follows Manku, Jain and Das Sarma, "Detecting Near-Duplicates for Web Crawling":
+//   - To search with threshold k, the 64 bits are split into k+1 blocks.
+//     If two fingerprints differ in at most k bits, at least one block is identical in both.
+//   - For every block there is a permuted copy of the fingerprints, rotated so the block
+//     sits in the top bits, and sorted.
+//   - A query binary-searches each permuted copy for fingerprints sharing that block,
+//     and only those candidates get their Hamming distance checked.
+//
+// The permuted copies are built lazily, once per threshold, and reused after that.
+// Results are exactly the ones a full scan would return.
+type Table struct {
+	hashes []uint64 // distinct fingerprints, sorted
+
+	mu    sync.Mutex
+	perms map[int][]permutation // permuted copies, keyed by number of blocks
+}
+
+// permutation is one block's sorted copy of the fingerprints
+type permutation struct {
+	shift  int      // rotating left by shift moves the block to the top bits
+	width  int      // block width in bits
+	sorted []uint64 // rotated fingerprints, sorted
+}
+
+// NewTable creates a table over the given fingerprints. Duplicates are dropped.
+func NewTable(hashes []uint64) *Table {
+	sorted := slices.Clone(hashes)
+	slices.Sort(sorted)
+	return &Table{
+		hashes: slices.Compact(sorted),
+		perms:  make(map[int][]permutation),
+	}
+}
+
+// Len returns the number of distinct fingerprints in the table
+func (t *Table) Len() int {
+	return len(t.hashes)
+}
+
+// Search returns every fingerprint within Hamming distance k of query, in ascending order.
+func (t *Table) Search(query uint64, k int) []uint64 {
+	switch {
+	case k < 0:
+		return nil
+	case k == 0:
+		if _, found := slices.BinarySearch(t.hashes, query); found {
+			return []uint64{query}
+		}
+		return nil
+	case k+1 > MaxTableBlocks:
+		return t.Scan(query, k)
+	}
+
+	var matches []uint64
+	seen := make(map[uint64]bool)
+	for _, perm := range t.permutations(k + 1) {
+		rotated := bits.RotateLeft64(query, perm.shift)
+		mask := ^uint64(0) << (64 - perm.width)
+		low := rotated & mask
+
+		// every fingerprint sharing this block sits in one sorted run starting at low
+		i, _ := slices.BinarySearch(perm.sorted, low)
+		for ; i < len(perm.sorted) && perm.sorted[i]&mask == low; i++ {
+			if HammingDistance(perm.sorted[i], rotated) > k {
+				continue
+			}
+			candidate := bits.RotateLeft64(perm.sorted[i], -perm.shift)
+			if !seen[candidate] {
+				seen[candidate] = true
+				matches = append(matches, candidate)
+			}
+		}
+	}
+
+	slices.Sort(matches)
+	return matches
+}
+
+// Scan is the brute-force search: it compares the query against every fingerprint.
+// It returns the same results as Search and is used when the threshold is too large
+// for the permuted tables to help.
+func (t *Table) Scan(query uint64, k int) []uint64 {
+	var matches []uint64
+	for _, hash := range t.hashes {
+		if HammingDistance(hash, query) <= k {
+			matches = append(matches, hash)
+		}
+	}
+	return matches
+}
+
+// permutations returns the permuted copies for the given number of blocks, building them on first use
+func (t *Table) permutations(blocks int) []permutation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if perms, ok := t.perms[blocks]; ok {
+		return perms
+	}
+
+	perms := make([]permutation, blocks)
+	start := 0
+	for b := range blocks {
+		// spread the 64 bits as evenly as possible, earlier blocks take the remainder
+		width := 64 / blocks
+		if b < 64%blocks {
+			width++
+		}
+
+		sorted := make([]uint64, len(t.hashes))
+		for i, hash := range t.hashes {
+			sorted[i] = bits.RotateLeft64(hash, start)
+		}
+		slices.Sort(sorted)
+
+		perms[b] = permutation{shift: start, width: width, sorted: sorted}
+		start += width
+	}
+
+	t.perms[blocks] = perms
+	return perms
+}
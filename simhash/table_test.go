@@ -0,0 +1,83 @@
+package simhash
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// randomHashes returns n random fingerprints, with every tenth one a near-duplicate
+// (a few flipped bits) of an earlier one so fuzzy searches have something to find
+func randomHashes(n int, seed int64) []uint64 {
+	rng := rand.New(rand.NewSource(seed))
+	hashes := make([]uint64, n)
+	for i := range hashes {
+		if i > 0 && i%10 == 0 {
+			hash := hashes[rng.Intn(i)]
+			for range rng.Intn(6) {
+				hash ^= 1 << rng.Intn(64)
+			}
+			hashes[i] = hash
+			continue
+		}
+		hashes[i] = rng.Uint64()
+	}
+	return hashes
+}
+
+func TestTableSearchMatchesScan(t *testing.T) {
+	hashes := randomHashes(5000, 1)
+	table := NewTable(hashes)
+	rng := rand.New(rand.NewSource(2))
+
+	for k := 0; k <= MaxTableBlocks+1; k++ {
+		for q := 0; q < 50; q++ {
+			query := hashes[rng.Intn(len(hashes))] ^ (1 << rng.Intn(64))
+			got := table.Search(query, k)
+			want := table.Scan(query, k)
+			if !slices.Equal(got, want) {
+				t.Fatalf("k=%d query=%d: Search() returned %d matches, Scan() returned %d", k, query, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestTableSearch(t *testing.T) {
+	table := NewTable([]uint64{0b1111, 0b1110, 0b1100, 0b1111, 1 << 63})
+
+	if table.Len() != 4 {
+		t.Errorf("expected duplicates to be dropped, got %d fingerprints", table.Len())
+	}
+	if got := table.Search(0b1111, 0); !slices.Equal(got, []uint64{0b1111}) {
+		t.Errorf("exact search = %v", got)
+	}
+	if got := table.Search(0b1111, 2); !slices.Equal(got, []uint64{0b1100, 0b1110, 0b1111}) {
+		t.Errorf("fuzzy search = %v", got)
+	}
+	if got := table.Search(0, -1); got != nil {
+		t.Errorf("negative threshold should match nothing, got %v", got)
+	}
+}
+
+func benchmarkSearch(b *testing.B, k int, search func(*Table, uint64, int) []uint64) {
+	hashes := randomHashes(1_000_000, 3)
+	table := NewTable(hashes)
+	table.Search(hashes[0], k) // build the permuted copies outside the timer
+
+	rng := rand.New(rand.NewSource(4))
+	queries := make([]uint64, 1024)
+	for i := range queries {
+		queries[i] = hashes[rng.Intn(len(hashes))] ^ (1 << rng.Intn(64))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		search(table, queries[i%len(queries)], k)
+	}
+}
+
+// go test ./simhash -bench . -run ^$
+func BenchmarkTableSearchK3(b *testing.B) { benchmarkSearch(b, 3, (*Table).Search) }
+func BenchmarkTableScanK3(b *testing.B)   { benchmarkSearch(b, 3, (*Table).Scan) }
+func BenchmarkTableSearchK6(b *testing.B) { benchmarkSearch(b, 6, (*Table).Search) }
+func BenchmarkTableScanK6(b *testing.B)   { benchmarkSearch(b, 6, (*Table).Scan) }
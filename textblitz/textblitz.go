@@ -0,0 +1,324 @@
+// Package textblitz is the public Go API for building SimHash indexes and searching them.
+//
+// Build an index from any reader or from a file, save it, and search it later:
+//
+//	idx, err := textblitz.Index(ctx, strings.NewReader(text), textblitz.IndexOptions{Name: "notes.txt"})
+//	if err != nil { ... }
+//	if err := idx.Save("notes.idx"); err != nil { ... }
+//
+//	searcher, err := textblitz.Open("notes.idx")
+//	if err != nil { ... }
+//	defer searcher.Close()
+//	matches, err := searcher.Search(textblitz.TextQuery("some passage"), textblitz.SearchOptions{Threshold: 3, TopK: 10})
+//
+// Nothing in this package prints; results come back as typed values.
+package textblitz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bravian1/Textblitz/internals"
+	idx "github.com/bravian1/Textblitz/internals/indexer"
+	"github.com/bravian1/Textblitz/simhash"
+)
+
+// DefaultChunkSize is the chunk size used when IndexOptions.ChunkSize is zero
+const DefaultChunkSize = 4096
+
+// DefaultWorkers is the number of hashing goroutines used when IndexOptions.Workers is zero
+const DefaultWorkers = 4
+
+type (
+	// IndexOptions controls how input is chunked and hashed
+	IndexOptions = internals.IndexOptions
+	// WalkOptions selects the files a directory or glob input expands to, see ExpandInput
+	WalkOptions = internals.WalkOptions
+	// FileRecord is the size, modification time and checksum of an indexed file
+	FileRecord = internals.FileRecord
+	// UpdateSummary counts the files an update added, changed, removed and left alone
+	UpdateSummary = internals.UpdateSummary
+	// RemoveSummary lists the files a removal dropped and counts their entries
+	RemoveSummary = internals.RemoveSummary
+	// MergeSummary counts the indexes merged, their entries and the duplicates left out
+	MergeSummary = internals.MergeSummary
+	// FeatureOptions selects the feature set text is hashed with (word or n-gram)
+	FeatureOptions = internals.FeatureOptions
+	// IndexHeader records how an index was built: chunk size, feature set, versions
+	IndexHeader = internals.IndexHeader
+	// SearchOptions controls the threshold, top-k and paging of a search
+	SearchOptions = internals.SearchOptions
+	// IndexEntry is a single indexed chunk: its source, byte position, size and keywords
+	IndexEntry = internals.IndexEntry
+	// Match is a search result: an entry, its SimHash and its distance from the query
+	Match = internals.Match
+	// Excerpt is a chunk's text read back from its source, with surrounding context
+	Excerpt = idx.Excerpt
+	// BinaryError reports input that isn't text, which is not indexed
+	BinaryError = idx.BinaryError
+	// JSONCopyError reports that Save wrote the index but not the JSON copy next to it
+	JSONCopyError = internals.JSONCopyError
+	// Fingerprint is a 64-bit SimHash value
+	Fingerprint = simhash.Fingerprint
+	// Format is how fingerprints are written: Decimal, Hex or Binary
+	Format = simhash.Format
+	// BatchQuery is one query of a batch search, see ReadBatch
+	BatchQuery = internals.BatchQuery
+	// BatchResult is the outcome of one batch query: its matches or its error
+	BatchResult = internals.BatchResult
+)
+
+// Fingerprint formats
+const (
+	Decimal = simhash.Decimal
+	Hex     = simhash.Hex
+	Binary  = simhash.Binary
+)
+
+// Searcher holds an index in memory and answers searches against it.
+// It is safe for concurrent searches once built or opened.
+type Searcher struct {
+	im     *internals.IndexManager
+	reader *idx.ChunkReader
+}
+
+// Index reads text from r, chunks and hashes it, and returns a searcher over the result.
+// opts.Name is recorded as the source of every chunk; if it ends in .pdf, .docx or .xml,
+// r is read as such a document rather than as plain text.
+func Index(ctx context.Context, r io.Reader, opts IndexOptions) (*Searcher, error) {
+	im := internals.NewIndexManager()
+	if err := im.IndexReader(ctx, r, withDefaults(opts)); err != nil {
+		return nil, err
+	}
+	return newSearcher(im), nil
+}
+
+// IndexFile chunks and hashes a .txt, .pdf or .docx file and returns a searcher over the result
+func IndexFile(ctx context.Context, path string, opts IndexOptions) (*Searcher, error) {
+	im := internals.NewIndexManager()
+	if err := im.IndexFile(ctx, path, withDefaults(opts)); err != nil {
+		return nil, err
+	}
+	return newSearcher(im), nil
+}
+
+// IndexFiles chunks and hashes every file into one combined index, opts.FileWorkers
+// files at a time, and returns a searcher over the result
+func IndexFiles(ctx context.Context, paths []string, opts IndexOptions) (*Searcher, error) {
+	im := internals.NewIndexManager()
+	if err := im.IndexFiles(ctx, paths, withDefaults(opts)); err != nil {
+		return nil, err
+	}
+	return newSearcher(im), nil
+}
+
+// ExpandInput returns the files a file, directory or glob pattern ("docs/**/*.pdf") stands for
+func ExpandInput(input string, opts WalkOptions) ([]string, error) {
+	return internals.ExpandInput(input, opts)
+}
+
+// Open loads an index file written by Save (or by the textindex CLI).
+//
+// Index files in the binary format are memory-mapped instead of decoded, so opening
+// takes about the same time for any size of index. Call Close when done with the Searcher.
+func Open(path string) (*Searcher, error) {
+	im := internals.NewIndexManager()
+	if err := im.Load(path); err != nil {
+		return nil, err
+	}
+	return newSearcher(im), nil
+}
+
+// Merge loads the index files and merges them into one: the entries of all of them,
+// without exact duplicates. The indexes must have been chunked and hashed the same way.
+// Save the searcher to write the merged index.
+func Merge(paths []string) (*Searcher, MergeSummary, error) {
+	im, summary, err := internals.MergeIndexes(paths)
+	if err != nil {
+		return nil, summary, err
+	}
+	return newSearcher(im), summary, nil
+}
+
+// Close releases the mapped index file. Matches already returned stay valid.
+func (s *Searcher) Close() error {
+	return s.im.Close()
+}
+
+// Update re-indexes only the paths that are new or changed since the index was built,
+// and drops the entries of indexed files that are not in paths any more. The files are
+// chunked and hashed with the options recorded in the index header; only the worker
+// counts of opts are used. Save the searcher to keep the result.
+func (s *Searcher) Update(ctx context.Context, paths []string, opts IndexOptions) (UpdateSummary, error) {
+	return s.im.UpdateFiles(ctx, paths, withDefaults(opts))
+}
+
+// Remove drops the entries of every file matching pattern: a path as it was indexed, or a
+// glob pattern such as "*.pdf" or "docs/drafts/**". Save the searcher to keep the result.
+func (s *Searcher) Remove(pattern string) (RemoveSummary, error) {
+	return s.im.RemoveFiles(pattern)
+}
+
+// Files returns the size, modification time and checksum of every file in the index
+func (s *Searcher) Files() []FileRecord {
+	return s.im.Files()
+}
+
+// SetHashFormat sets how SimHash keys are written in the JSON copy Save writes next to the index
+func (s *Searcher) SetHashFormat(format Format) {
+	s.im.SetHashFormat(format)
+}
+
+// Save writes the index to path, and a human-readable JSON copy to path + ".json".
+// If only the copy can't be written, the index is saved and the error is a *JSONCopyError.
+func (s *Searcher) Save(path string) error {
+	return s.im.Save(path)
+}
+
+// Query is what to search for: either a SimHash or text that gets hashed
+// the same way the index was built. Use HashQuery or TextQuery to make one.
+type Query struct {
+	hash     Fingerprint
+	text     string
+	hasHash  bool
+	features *FeatureOptions
+}
+
+// HashQuery searches for a precomputed SimHash
+func HashQuery(hash Fingerprint) Query {
+	return Query{hash: hash, hasHash: true}
+}
+
+// TextQuery searches for the SimHash of text
+func TextQuery(text string) Query {
+	return Query{text: text}
+}
+
+// WithFeatures pins the feature options a text query is hashed with. Without it, a
+// Searcher hashes query text with the options recorded in its index header; with it,
+// searching an index built with different options is an error rather than a silent miss.
+func (q Query) WithFeatures(f FeatureOptions) Query {
+	q.features = &f
+	return q
+}
+
+// Hash returns the SimHash the query searches for. Text is hashed with the
+// options given to WithFeatures, or the default word features.
+func (q Query) Hash() (Fingerprint, error) {
+	if q.hasHash {
+		return q.hash, nil
+	}
+	if strings.TrimSpace(q.text) == "" {
+		return 0, fmt.Errorf("empty query")
+	}
+	if q.features != nil {
+		return q.features.Hash(q.text), nil
+	}
+	return Hash(q.text), nil
+}
+
+// Header returns the header of the index: how it was chunked and hashed.
+// Indexes written before headers existed have an empty header (Known() is false).
+func (s *Searcher) Header() IndexHeader {
+	return s.im.Header()
+}
+
+// CheckFeatures returns an error if text hashed with f can't be compared with this index
+func (s *Searcher) CheckFeatures(f FeatureOptions) error {
+	return s.im.Header().CheckFeatures(f)
+}
+
+// HashQuery returns the SimHash q searches for in this index. Text queries are hashed
+// with the index's own feature options, or with the ones pinned by WithFeatures after
+// checking that they match the index.
+func (s *Searcher) HashQuery(q Query) (Fingerprint, error) {
+	switch {
+	case q.hasHash:
+		return q.hash, nil
+	case strings.TrimSpace(q.text) == "":
+		return 0, fmt.Errorf("empty query")
+	case q.features != nil:
+		if err := s.CheckFeatures(*q.features); err != nil {
+			return 0, err
+		}
+		return q.features.Hash(q.text), nil
+	default:
+		return s.im.HashText(q.text), nil
+	}
+}
+
+// Search returns the matches for q, closest first. See SearchOptions for the threshold, top-k and paging.
+func (s *Searcher) Search(q Query, opts SearchOptions) ([]Match, error) {
+	hash, err := s.HashQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Threshold < 0 || opts.TopK < 0 || opts.Offset < 0 {
+		return nil, fmt.Errorf("threshold, top-k and offset must not be negative")
+	}
+	return s.im.Search(hash, opts), nil
+}
+
+// SearchBatch runs many queries against the index with the given number of workers
+// and returns one result per query, in the same order. A query that fails (for example
+// a malformed line from ReadBatch) gets an error in its result; the others still run.
+func (s *Searcher) SearchBatch(ctx context.Context, queries []BatchQuery, opts SearchOptions, workers int) []BatchResult {
+	return s.im.SearchBatch(ctx, queries, opts, workers)
+}
+
+// ReadBatch reads batch queries, one per line: JSON objects {"id", "hash" or "text"},
+// or plain lines holding a SimHash (or the query text, when textLines is set).
+func ReadBatch(r io.Reader, textLines bool) ([]BatchQuery, error) {
+	return internals.ReadBatchQueries(r, textLines)
+}
+
+// EntriesAt returns the entries whose chunk starts at position. An empty file matches any source.
+func (s *Searcher) EntriesAt(file string, position int) []IndexEntry {
+	return s.im.EntriesAt(file, position)
+}
+
+// Text reads an entry's chunk back from its source file, with up to context bytes on each side.
+// Sources are read as the type and in the encoding they were indexed as.
+func (s *Searcher) Text(entry IndexEntry, context int) (Excerpt, error) {
+	if err := s.im.Header().CheckSource(entry.OriginalFile); err != nil {
+		return Excerpt{}, err
+	}
+	return s.reader.Read(entry.OriginalFile, entry.Position, entry.Size, context)
+}
+
+// Hash returns the SimHash of text, as the indexer would compute it for a chunk
+func Hash(text string) Fingerprint {
+	return FeatureOptions{}.Hash(text)
+}
+
+// ParseHash parses a SimHash written in decimal, hex (with or without 0x) or 64-digit binary
+func ParseHash(s string) (Fingerprint, error) {
+	return simhash.ParseFingerprint(s)
+}
+
+// ParseFormat parses a fingerprint format name: "decimal", "hex" or "binary"
+func ParseFormat(name string) (Format, error) {
+	return simhash.ParseFormat(name)
+}
+
+// newSearcher returns a searcher over an index that has been built or loaded. The
+// chunk reader is set up for the index's sources here, once, as it is shared by
+// every call to Text.
+func newSearcher(im *internals.IndexManager) *Searcher {
+	reader := idx.NewChunkReader()
+	reader.SetReadOptions(im.Header().ReadOptions())
+	return &Searcher{im: im, reader: reader}
+}
+
+// withDefaults fills in the zero-valued options
+func withDefaults(opts IndexOptions) IndexOptions {
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.Workers == 0 {
+		opts.Workers = DefaultWorkers
+	}
+	return opts
+}
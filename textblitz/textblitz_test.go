@@ -0,0 +1,145 @@
+package textblitz
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIndexSaveOpenSearch(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20) +
+		strings.Repeat("Pack my box with five dozen liquor jugs. ", 20)
+
+	idx, err := Index(context.Background(), strings.NewReader(text), IndexOptions{Name: "pangrams.txt", ChunkSize: 900})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "pangrams.idx")
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	searcher, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	matches, err := searcher.Search(TextQuery(text[:900]), SearchOptions{TopK: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	if matches[0].OriginalFile != "pangrams.txt" || matches[0].Position != 0 || matches[0].Distance != 0 {
+		t.Errorf("unexpected match: %+v", matches[0])
+	}
+
+	byHash, err := searcher.Search(HashQuery(matches[0].SimHash), SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byHash) == 0 || byHash[0].SimHash != matches[0].SimHash {
+		t.Errorf("hash query did not find %d", matches[0].SimHash)
+	}
+
+	if _, err := searcher.Search(TextQuery("  "), SearchOptions{}); err == nil {
+		t.Error("expected an error for an empty query")
+	}
+}
+
+func TestIndexCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Index(ctx, strings.NewReader(strings.Repeat("text ", 10000)), IndexOptions{}); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSearchUsesIndexFeatures(t *testing.T) {
+	text := strings.Repeat("Pack my box with five dozen liquor jugs. ", 40)
+	ngram := FeatureOptions{FeatureSet: "ngram", NgramN: 4}
+
+	idx, err := Index(context.Background(), strings.NewReader(text), IndexOptions{Name: "jugs.txt", ChunkSize: 800, Features: ngram})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jugs.idx")
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	searcher, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+	if got := searcher.Header().Features(); got.FeatureSet != "ngram" || got.NgramN != 4 {
+		t.Errorf("unexpected header features: %s", got)
+	}
+
+	matches, err := searcher.Search(TextQuery(text[:800]), SearchOptions{TopK: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Distance != 0 {
+		t.Errorf("expected an exact match hashing with the index features, got %+v", matches)
+	}
+
+	if _, err := searcher.Search(TextQuery(text[:800]).WithFeatures(FeatureOptions{}), SearchOptions{}); err == nil {
+		t.Error("expected an error searching an ngram index with word features")
+	}
+}
+
+func TestTextConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cafe.txt")
+	if err := os.WriteFile(path, []byte("caf\xe9 cr\xe8me br\xfbl\xe9e"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := IndexFile(context.Background(), path, IndexOptions{ChunkSize: 64, Encoding: "latin1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := idx.EntriesAt(path, 0)
+	if len(entries) != 1 {
+		t.Fatalf("expected one chunk, got %+v", entries)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			excerpt, err := idx.Text(entries[0], 0)
+			if err != nil || string(excerpt.Text) != "café crème brûlée" {
+				t.Errorf("expected the chunk decoded from Latin-1, got %q, %v", excerpt.Text, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSaveJSONCopyError(t *testing.T) {
+	idx, err := Index(context.Background(), strings.NewReader("some text"), IndexOptions{Name: "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "a.idx")
+	if err := os.Mkdir(path+".json", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var jsonErr *JSONCopyError
+	if err := idx.Save(path); !errors.As(err, &jsonErr) || jsonErr.Path != path+".json" {
+		t.Fatalf("expected a JSONCopyError for %s, got %v", path+".json", err)
+	}
+	if _, err := Open(path); err != nil {
+		t.Errorf("expected the index to be saved anyway, got %v", err)
+	}
+}